@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"ytkb/internal/api"
+	"ytkb/internal/plan"
+
+	"github.com/spf13/cobra"
+)
+
+func applyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "apply <planfile>",
+		Short: "Push the changes of a saved plan",
+		Long: "Push exactly the changes saved by `ytkb plan --out`. Nothing is pushed if the server " +
+			"or the local files changed since the plan was made.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		PreRunE:      loadConfig,
+		RunE:         perKB(runApply),
+	}
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+	saved, err := plan.ReadSaved(args[0])
+	if err != nil {
+		return err
+	}
+	if !sameURL(saved.URL, cfg.URL) || saved.KB != cfg.KBKey {
+		return fmt.Errorf("plan was made for knowledge base %s on %s", saved.KB, saved.URL)
+	}
+
+	client := api.NewClient(cfg)
+	allArticles, err := client.ListArticles()
+	if err != nil {
+		return fmt.Errorf("failed to list server articles: %w", err)
+	}
+
+	st, err := loadState()
+	if err != nil {
+		return err
+	}
+
+	serverArticles, files, err := scopeWorkspace(allArticles)
+	if err != nil {
+		return err
+	}
+
+	p := newPlanner(st, saved.Options.Format).Plan(files, serverArticles)
+
+	serverDrift, localDrift := saved.Drift(p, files)
+	if len(serverDrift) > 0 || len(localDrift) > 0 {
+		if len(serverDrift) > 0 {
+			fmt.Println("Changed on the server since the plan was made:")
+			for _, article := range serverDrift {
+				fmt.Printf("   %s\n", article)
+			}
+		}
+		if len(localDrift) > 0 {
+			fmt.Println("Changed locally since the plan was made:")
+			for _, path := range localDrift {
+				fmt.Printf("   %s\n", path)
+			}
+		}
+		return fmt.Errorf("plan is out of date, run ytkb plan again")
+	}
+
+	// Same inputs should give the same changes, unless ytkb.yaml or the
+	// server's tags changed
+	pages := p.Pushable(saved.Options.Prune)
+	deletions, err := selectRemovals(p, allArticles, saved.Options)
+	if err != nil {
+		return err
+	}
+	resolver := newTagResolver(client, saved.Options.CreateTags)
+	current, err := savePlan(p, resolver, saved.Options, deletions, files)
+	if err != nil {
+		return err
+	}
+	if !saved.Same(current) {
+		return fmt.Errorf("plan no longer matches the workspace, run ytkb plan again")
+	}
+
+	if len(pages) == 0 && len(deletions) == 0 {
+		fmt.Println("No changes to push.")
+		return nil
+	}
+	if err := resolver.check(tagDiffs(pages)...); err != nil {
+		return err
+	}
+
+	var failures []string
+	if len(pages) > 0 {
+		if failed := executeUpdates(client, st, resolver, pages, saved.Options.Prune); failed > 0 {
+			failures = append(failures, fmt.Sprintf("push %d of %d articles", failed, len(pages)))
+		}
+	}
+	if len(deletions) > 0 && saved.Options.Archive {
+		if failed := archiveArticles(client, st, allArticles, deletions); failed > 0 {
+			failures = append(failures, fmt.Sprintf("archive %d of %d articles", failed, len(deletions)))
+		}
+	} else if len(deletions) > 0 {
+		if failed := deleteArticles(client, st, deletions); failed > 0 {
+			failures = append(failures, fmt.Sprintf("delete %d of %d articles", failed, len(deletions)))
+		}
+	}
+	if err := st.Save("."); err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to %s", strings.Join(failures, " and "))
+	}
+
+	fmt.Println("\nApply complete.")
+	return nil
+}
+
+// sameURL compares server URLs, ignoring the case of the scheme and host
+// and trailing slashes
+func sameURL(a, b string) bool {
+	normalize := func(raw string) string {
+		u, err := url.Parse(strings.TrimRight(raw, "/"))
+		if err != nil {
+			return raw
+		}
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+		return u.String()
+	}
+	return normalize(a) == normalize(b)
+}
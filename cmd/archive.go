@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"ytkb/internal/api"
+	"ytkb/internal/archive"
+	"ytkb/internal/plan"
+	"ytkb/internal/state"
+
+	"github.com/spf13/cobra"
+)
+
+func restoreCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          "restore <id>",
+		Short:        "Move an archived article back to where it was",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		PreRunE:      loadConfig,
+		RunE:         perKB(runRestore),
+	}
+}
+
+// findArchive returns the archive article, nil if there is none. It is
+// always created at the top level, so only top-level articles are matched.
+func findArchive(articles []api.Article, settings archive.Settings) *api.Article {
+	for i := range articles {
+		if (articles[i].ParentID == nil || *articles[i].ParentID == "") && articles[i].Title == settings.ArticleTitle() {
+			return &articles[i]
+		}
+	}
+	return nil
+}
+
+// withoutArchive drops the archive article, and what is already in it,
+// from articles to archive
+func withoutArchive(deletions []deletion, articles []api.Article, archived *api.Article) []deletion {
+	if archived == nil {
+		return deletions
+	}
+	parents := make(map[string]string)
+	for _, article := range articles {
+		if article.ParentID != nil {
+			parents[article.ID] = *article.ParentID
+		}
+	}
+	inArchive := func(id string) bool {
+		for seen := 0; id != "" && seen <= len(parents); seen++ {
+			if id == archived.ID {
+				return true
+			}
+			id = parents[id]
+		}
+		return false
+	}
+
+	var kept []deletion
+	for _, d := range deletions {
+		if inArchive(d.article.ID) {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+// printArchives lists the articles a push archives
+func printArchives(deletions []deletion) {
+	fmt.Printf("\nArticles to be moved to %s:\n", cfg.Project.Archive.ArticleTitle())
+	for _, d := range deletions {
+		fmt.Printf("   🗄  %s", d.article.Title)
+		if len(d.descendants) > 0 {
+			fmt.Printf(" (with %d sub-articles)", len(d.descendants))
+		}
+		fmt.Println()
+	}
+}
+
+// archiveArticles moves articles under the archive article, creating it if
+// needed, and returns how many failed. Each article's content records its
+// parent so restore can move it back.
+func archiveArticles(client *api.Client, st *state.State, articles []api.Article, deletions []deletion) int {
+	settings := cfg.Project.Archive
+
+	archived := findArchive(articles, settings)
+	if archived == nil {
+		created, err := client.CreateArticle(settings.ArticleTitle(), "", nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", settings.ArticleTitle(), err)
+			return len(deletions)
+		}
+		archived = created
+	}
+
+	// The archive tag is configured on purpose, so it may be created
+	resolver := newTagResolver(client, true)
+	failed := 0
+
+	for _, d := range deletions {
+		if err := archiveArticle(client, resolver, d.article, archived.ID, settings); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to archive %s: %v\n", d.article.Title, err)
+			failed++
+			continue
+		}
+		delete(st.Articles, d.article.ID)
+		for _, child := range d.descendants {
+			delete(st.Articles, child.ID)
+		}
+		fmt.Printf("Archived: %s\n", d.article.Title)
+	}
+	return failed
+}
+
+func archiveArticle(client *api.Client, resolver *tagResolver, article *api.Article, archiveID string, settings archive.Settings) error {
+	parentID := ""
+	if article.ParentID != nil {
+		parentID = *article.ParentID
+	}
+
+	// Record the parent before moving, and undo that if the move fails
+	if _, err := client.UpdateArticle(article.ID, settings.ArchivedTitle(article.Title), archive.Mark(article.Content, parentID)); err != nil {
+		return fmt.Errorf("failed to update article: %w", err)
+	}
+	if err := client.MoveArticle(article.ID, archiveID); err != nil {
+		if _, undoErr := client.UpdateArticle(article.ID, article.Title, article.Content); undoErr != nil {
+			return fmt.Errorf("failed to move article: %w (and failed to restore its title and content: %v)", err, undoErr)
+		}
+		return fmt.Errorf("failed to move article: %w", err)
+	}
+
+	if settings.Tag == "" {
+		return nil
+	}
+	for _, tag := range article.Tags {
+		if tag.Name == settings.Tag {
+			return nil
+		}
+	}
+	return resolver.apply(article.ID, plan.TagDiff{Add: []string{settings.Tag}})
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	settings := cfg.Project.Archive
+
+	client := api.NewClient(cfg)
+	articles, err := client.ListArticles()
+	if err != nil {
+		return fmt.Errorf("failed to list server articles: %w", err)
+	}
+
+	var article *api.Article
+	byID := make(map[string]*api.Article)
+	for i := range articles {
+		byID[articles[i].ID] = &articles[i]
+		if articles[i].ID == args[0] || articles[i].IDReadable == args[0] {
+			article = &articles[i]
+		}
+	}
+	if article == nil {
+		return fmt.Errorf("article %s not found on server", args[0])
+	}
+
+	content, parentID, ok := archive.Unmark(article.Content)
+	if !ok {
+		return fmt.Errorf("%s was not archived by ytkb", article.Title)
+	}
+	if _, exists := byID[parentID]; parentID != "" && !exists {
+		fmt.Printf("⚠️  The original parent %s no longer exists, restoring to the top level\n", parentID)
+		parentID = ""
+	}
+
+	if err := client.MoveArticle(article.ID, parentID); err != nil {
+		return fmt.Errorf("failed to move article: %w", err)
+	}
+	title := settings.RestoredTitle(article.Title)
+	if _, err := client.UpdateArticle(article.ID, title, content); err != nil {
+		return fmt.Errorf("failed to update article: %w", err)
+	}
+
+	for _, tag := range article.Tags {
+		if settings.Tag != "" && tag.Name == settings.Tag {
+			resolver := newTagResolver(client, false)
+			if err := resolver.apply(article.ID, plan.TagDiff{Remove: []api.Tag{tag}}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Like archiving, forget the articles that have no local file, so they
+	// come back as new downloads rather than as local deletions
+	st, err := loadState()
+	if err != nil {
+		return err
+	}
+	restored := append([]*api.Article{article}, subArticles(articles, article.ID)...)
+	for _, a := range restored {
+		if entry, ok := st.Articles[a.ID]; ok && !fileExists(entry.Path) {
+			delete(st.Articles, a.ID)
+		}
+	}
+	if err := st.Save("."); err != nil {
+		return err
+	}
+
+	parent := "the top level"
+	if parentID != "" {
+		parent = byID[parentID].Title
+	}
+	fmt.Printf("Restored %s", title)
+	if len(restored) > 1 {
+		fmt.Printf(" with %d sub-articles", len(restored)-1)
+	}
+	fmt.Printf(" under %s. Run ytkb download to get it back locally.\n", parent)
+	return nil
+}
+
+// subArticles returns every article below id
+func subArticles(articles []api.Article, id string) []*api.Article {
+	var below []*api.Article
+	for i := range articles {
+		if articles[i].ParentID != nil && *articles[i].ParentID == id {
+			below = append(below, &articles[i])
+			below = append(below, subArticles(articles, articles[i].ID)...)
+		}
+	}
+	return below
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return path != "" && err == nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"ytkb/internal/api"
+	"ytkb/internal/assets"
+	"ytkb/internal/plan"
+	"ytkb/internal/state"
+)
+
+// pushAttachments uploads new and changed attachments of an article and
+// records them in the sync state
+func pushAttachments(client *api.Client, st *state.State, articleID string, changes []plan.AttachmentChange) error {
+	for _, change := range changes {
+		if !change.Upload() {
+			continue
+		}
+
+		data, err := os.ReadFile(change.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read attachment %s: %w", change.Path, err)
+		}
+
+		uploaded, err := client.UploadAttachment(articleID, change.Name, data)
+		if err != nil {
+			return fmt.Errorf("failed to upload attachment %s: %w", change.Name, err)
+		}
+		for _, attachment := range uploaded {
+			if attachment.Name == change.Name && attachment.ID != change.ID {
+				st.Article(articleID).SetAttachment(change.Name, state.Attachment{
+					ID:   attachment.ID,
+					Hash: assets.HashBytes(data),
+					Size: int64(len(data)),
+				})
+			}
+		}
+		fmt.Printf("Uploaded: %s\n", change.Path)
+
+		// YouTrack can't replace an attachment's content, so the old one is
+		// removed once the new one is uploaded and recorded. Failing that
+		// only leaves a stale copy on the server.
+		if change.Status == plan.AttachmentChanged {
+			if err := client.DeleteAttachment(articleID, change.ID); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to remove previous version of attachment %s: %v\n", change.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// pruneAttachments removes server attachments the article no longer uses
+func pruneAttachments(client *api.Client, st *state.State, articleID string, changes []plan.AttachmentChange) error {
+	for _, change := range changes {
+		if !change.Prunable() {
+			continue
+		}
+		if err := client.DeleteAttachment(articleID, change.ID); err != nil {
+			return fmt.Errorf("failed to remove attachment %s: %w", change.Name, err)
+		}
+		if entry, ok := st.Articles[articleID]; ok {
+			delete(entry.Attachments, change.Name)
+		}
+		fmt.Printf("Removed attachment: %s\n", change.Name)
+	}
+	return nil
+}
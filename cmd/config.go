@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"ytkb/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show and change settings",
+		Long: "Show and change settings. url, token and token_command are global and belong to the profile " +
+			"chosen with --profile, or to [config]. kb is the knowledge base of this workspace, kept in .env. " +
+			"Every other key is a setting of ytkb.yaml, with dots for nested settings such as compare.format. " +
+			"Tokens are masked in output.",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:          "list",
+		Short:        "List all settings",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runConfigList,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:          "get <key>",
+		Short:        "Show a setting",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE:         runConfigGet,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set <key> <value...>",
+		Short: "Change a setting",
+		Long: "Change a setting. List settings such as roots take several values. Without a value, token is asked " +
+			"for without echo. Setting token removes token_command and the other way round.",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE:         runConfigSet,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:          "unset <key>",
+		Short:        "Remove a setting",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE:         runConfigUnset,
+	})
+	return cmd
+}
+
+func runConfigList(cmd *cobra.Command, args []string) error {
+	profile := currentProfile()
+	global, err := config.GlobalSettings(profile)
+	if err != nil {
+		return err
+	}
+	path, err := config.ConfigPath()
+	if err != nil {
+		return err
+	}
+	printSettings(fmt.Sprintf("%s [%s]", path, sectionName(profile)), global)
+
+	kb, err := config.ReadKBKey()
+	if err != nil {
+		return err
+	}
+	if kb != "" {
+		printSettings(config.EnvFile, []config.Setting{{Key: config.KeyKB, Value: kb}})
+	}
+
+	project, err := config.ProjectSettings()
+	if err != nil {
+		return err
+	}
+	printSettings(config.ProjectFile, project)
+	return nil
+}
+
+func printSettings(source string, settings []config.Setting) {
+	if len(settings) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", source)
+	for _, setting := range settings {
+		fmt.Printf("  %s = %s\n", setting.Key, shownValue(setting))
+	}
+}
+
+func shownValue(setting config.Setting) string {
+	if config.IsSecret(setting.Key) {
+		return config.Mask(setting.Value)
+	}
+	return setting.Value
+}
+
+func sectionName(profile string) string {
+	if profile == "" {
+		return "config"
+	}
+	return profile
+}
+
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	key := args[0]
+	settings, err := settingsFor(key)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, setting := range settings {
+		// A group shows all of its settings
+		if setting.Key == key || strings.HasPrefix(setting.Key, key+".") {
+			found = true
+			if setting.Key == key {
+				fmt.Println(shownValue(setting))
+			} else {
+				fmt.Printf("%s = %s\n", setting.Key, shownValue(setting))
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s is not set", key)
+	}
+	return nil
+}
+
+// settingsFor returns the settings of the file a key belongs to
+func settingsFor(key string) ([]config.Setting, error) {
+	switch {
+	case config.IsGlobal(key):
+		return config.GlobalSettings(currentProfile())
+	case key == config.KeyKB:
+		kb, err := config.ReadKBKey()
+		if err != nil || kb == "" {
+			return nil, err
+		}
+		return []config.Setting{{Key: config.KeyKB, Value: kb}}, nil
+	}
+
+	settings, err := config.ProjectSettings()
+	if err != nil {
+		return nil, err
+	}
+	for _, setting := range settings {
+		if setting.Key == key || strings.HasPrefix(setting.Key, key+".") {
+			return settings, nil
+		}
+	}
+	return nil, config.CheckProjectKey(key)
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	key, values := args[0], args[1:]
+
+	// Typing the token keeps it out of the shell history
+	if key == config.KeyToken && len(values) == 0 {
+		token, err := ask("API token", "", true)
+		if err != nil {
+			return err
+		}
+		values = []string{token}
+	}
+
+	switch {
+	case config.IsGlobal(key) || key == config.KeyKB:
+		if len(values) != 1 {
+			return fmt.Errorf("%s takes a single value", key)
+		}
+		if key == config.KeyKB {
+			return config.SetKBKey(values[0])
+		}
+		// A profile has either a token or a command to get it
+		changes := map[string]string{key: values[0]}
+		switch key {
+		case config.KeyToken:
+			changes[config.KeyTokenCommand] = ""
+		case config.KeyTokenCommand:
+			changes[config.KeyToken] = ""
+		}
+		return config.SetGlobal(currentProfile(), changes)
+	case len(values) == 0:
+		return fmt.Errorf("missing value for %s", key)
+	}
+	return config.SetProject(key, values)
+}
+
+func runConfigUnset(cmd *cobra.Command, args []string) error {
+	key := args[0]
+	switch {
+	case config.IsGlobal(key):
+		return config.SetGlobal(currentProfile(), map[string]string{key: ""})
+	case key == config.KeyKB:
+		return config.SetKBKey("")
+	}
+	return config.UnsetProject(key)
+}
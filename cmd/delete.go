@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ytkb/internal/api"
+	"ytkb/internal/backup"
+	"ytkb/internal/plan"
+	"ytkb/internal/state"
+)
+
+// deletion is a server article to delete along with its sub-articles
+type deletion struct {
+	article     *api.Article
+	descendants []*api.Article
+}
+
+// count is how many articles the deletion removes
+func (d deletion) count() int {
+	return 1 + len(d.descendants)
+}
+
+// selectRemovals finds the server articles to delete or archive, as chosen
+// by the options
+func selectRemovals(p *plan.Plan, articles []api.Article, opts plan.Options) ([]deletion, error) {
+	switch {
+	case opts.Delete:
+		return selectDeletions(p, opts.Recursive)
+	case opts.Archive:
+		deletions, err := selectDeletions(p, true)
+		if err != nil {
+			return nil, err
+		}
+		return withoutArchive(deletions, articles, findArchive(articles, cfg.Project.Archive)), nil
+	}
+	return nil, nil
+}
+
+// removals records deletions in a saved plan
+func removals(deletions []deletion) []plan.Removal {
+	var saved []plan.Removal
+	for _, d := range deletions {
+		removal := plan.Removal{ID: d.article.ID, Title: d.article.Title}
+		for _, child := range d.descendants {
+			removal.Descendants = append(removal.Descendants, child.ID)
+		}
+		saved = append(saved, removal)
+	}
+	return saved
+}
+
+// selectDeletions finds the server articles push --delete removes: those
+// whose local file was deleted. Articles with sub-articles are only deleted
+// if recursive is set, and never while a sub-article still has a local file
+// or was never downloaded. Nothing is deleted while any local file can't
+// be read, as it might be the one that was thought deleted.
+func selectDeletions(p *plan.Plan, recursive bool) ([]deletion, error) {
+	if len(p.Deletions) > 0 && len(p.Invalid) > 0 {
+		paths := make([]string, len(p.Invalid))
+		for i, invalid := range p.Invalid {
+			paths[i] = invalid.Path
+		}
+		return nil, fmt.Errorf("refusing to delete or archive articles while files can't be read: %s", strings.Join(paths, ", "))
+	}
+
+	deleted := make(map[string]bool)
+	for _, d := range p.Deletions {
+		deleted[d.ID] = true
+	}
+	notDownloaded := make(map[string]bool)
+	for _, d := range p.Downloads {
+		notDownloaded[d.ID] = true
+	}
+	children := make(map[string][]*api.Article)
+	byID := make(map[string]*api.Article)
+	for i := range p.Server {
+		article := &p.Server[i]
+		byID[article.ID] = article
+		if article.ParentID != nil {
+			children[*article.ParentID] = append(children[*article.ParentID], article)
+		}
+	}
+
+	var descendants func(id string) []*api.Article
+	descendants = func(id string) []*api.Article {
+		var all []*api.Article
+		for _, child := range children[id] {
+			all = append(all, child)
+			all = append(all, descendants(child.ID)...)
+		}
+		return all
+	}
+
+	var deletions []deletion
+	var problems []string
+	for _, d := range p.Deletions {
+		article := byID[d.ID]
+		// Sub-articles go with their parent
+		if article.ParentID != nil && deleted[*article.ParentID] {
+			continue
+		}
+
+		below := descendants(article.ID)
+		var kept, remote []string
+		for _, child := range below {
+			if deleted[child.ID] {
+				continue
+			}
+			if notDownloaded[child.ID] {
+				remote = append(remote, child.Title)
+			} else {
+				kept = append(kept, child.Title)
+			}
+		}
+		switch {
+		case len(kept) > 0:
+			problems = append(problems, fmt.Sprintf("%s: sub-articles still exist locally: %s", article.Title, strings.Join(kept, ", ")))
+		case len(remote) > 0:
+			problems = append(problems, fmt.Sprintf("%s: sub-articles were never downloaded: %s", article.Title, strings.Join(remote, ", ")))
+		case len(below) > 0 && !recursive:
+			problems = append(problems, fmt.Sprintf("%s: has %d sub-articles (use --recursive)", article.Title, len(below)))
+		default:
+			deletions = append(deletions, deletion{article: article, descendants: below})
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("refusing to delete:\n   %s", strings.Join(problems, "\n   "))
+	}
+	return deletions, nil
+}
+
+// printDeletions lists the articles a push deletes
+func printDeletions(deletions []deletion) {
+	fmt.Println("\nArticles to be deleted from the server:")
+	for _, d := range deletions {
+		fmt.Printf("   ❌ %s (%s)\n", d.article.Title, d.article.URL)
+		for _, child := range d.descendants {
+			fmt.Printf("      ❌ %s\n", child.Title)
+		}
+	}
+}
+
+// confirmCount asks the user to type the number of articles to delete
+func confirmCount(count int) (bool, error) {
+	if !interactive {
+		return false, errNoPrompt(fmt.Sprintf("Delete %d articles?", count))
+	}
+	fmt.Printf("\nThis deletes %d articles from YouTrack. Type %d to confirm: ", count, count)
+	response, err := stdin.ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("failed to read response: %w", err)
+	}
+	return strings.TrimSpace(response) == strconv.Itoa(count), nil
+}
+
+// deleteArticles backs up and deletes articles, and returns how many of the
+// deletions failed. Nothing is deleted unless its backup was written.
+func deleteArticles(client *api.Client, st *state.State, deletions []deletion) int {
+	now := time.Now()
+	b := backup.New(".", now)
+	failed := 0
+
+	for _, d := range deletions {
+		articles := append([]*api.Article{d.article}, d.descendants...)
+		if err := backupArticles(client, st, b, articles, now); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to delete %s: %v\n", d.article.Title, err)
+			failed++
+			continue
+		}
+
+		// Sub-articles first, so a failure never leaves orphans behind
+		var err error
+		for i := len(articles) - 1; i >= 0 && err == nil; i-- {
+			if err = client.DeleteArticle(articles[i].ID); err == nil {
+				delete(st.Articles, articles[i].ID)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to delete %s: %v\n", d.article.Title, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Deleted: %s\n", d.article.Title)
+	}
+
+	if failed < len(deletions) {
+		fmt.Printf("Deleted articles are backed up in %s\n", b.Dir())
+	}
+	return failed
+}
+
+func backupArticles(client *api.Client, st *state.State, b *backup.Backup, articles []*api.Article, now time.Time) error {
+	for _, article := range articles {
+		record := backup.Record{Article: *article, Deleted: now}
+		if entry, ok := st.Articles[article.ID]; ok {
+			record.Path = entry.Path
+		}
+
+		attachments := make(map[string][]byte)
+		for _, attachment := range article.Attachments {
+			data, err := client.DownloadAttachment(attachment)
+			if err != nil {
+				return fmt.Errorf("failed to back up attachment %s: %w", attachment.Name, err)
+			}
+			attachments[attachment.Name] = data
+		}
+
+		if err := b.Save(record, attachments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -7,8 +7,7 @@ import (
 	"strings"
 
 	"ytkb/internal/api"
-	"ytkb/internal/filesystem"
-	"ytkb/internal/markdown"
+	"ytkb/internal/plan"
 
 	"github.com/spf13/cobra"
 )
@@ -20,33 +19,38 @@ const (
 	StatusModified
 	StatusNewLocal
 	StatusDeleted
+	StatusConflict
+	StatusNewServer
+	StatusDeletedServer
 )
 
 type ArticleNode struct {
-	ID       string
-	Title    string
-	Status   ArticleStatus
-	Children []*ArticleNode
-	Path     string
+	ID          string
+	Title       string
+	Status      ArticleStatus
+	Children    []*ArticleNode
+	Path        string
+	Notes       []string
+	Tags        plan.TagDiff
+	Attachments []plan.AttachmentChange
 }
 
+var diffFormat bool
+
 func diffCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "diff",
-		Short: "Show differences between local and server",
-		RunE:  runDiff,
+	cmd := &cobra.Command{
+		Use:     "diff",
+		Short:   "Show differences between local and server",
+		PreRunE: loadConfig,
+		RunE:    perKB(runDiff),
 	}
+	cmd.Flags().BoolVar(&diffFormat, "fmt", false, "Ignore differences that formatting would remove")
+	return cmd
 }
 
 func runDiff(cmd *cobra.Command, args []string) error {
 	fmt.Println("Comparing local files with server...")
 
-	// Get local files
-	localFiles, err := filesystem.FindMarkdownFiles(".")
-	if err != nil {
-		return fmt.Errorf("failed to find local files: %w", err)
-	}
-
 	// Get server articles
 	client := api.NewClient(cfg)
 	serverArticles, err := client.ListArticles()
@@ -54,78 +58,61 @@ func runDiff(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to list server articles: %w", err)
 	}
 
-	// Build maps
-	localByID := make(map[string]*markdown.MarkdownFile)
-	localPaths := make(map[string]string)
-	localByPath := make(map[string]*markdown.MarkdownFile) // For new files without ID
-	serverByID := make(map[string]*api.Article)
-
-	// Load local files
-	for _, filePath := range localFiles {
-		content, err := filesystem.ReadMarkdownFile(filePath)
-		if err != nil {
-			continue
-		}
+	st, err := loadState()
+	if err != nil {
+		return err
+	}
 
-		md, err := markdown.ParseMarkdown(content)
-		if err != nil {
-			continue
+	serverArticles, files, err := scopeWorkspace(serverArticles)
+	if err != nil {
+		return err
+	}
+	p := newPlanner(st, diffFormat).Plan(files, serverArticles)
+
+	// Describe every server article from the plan
+	nodes := make(map[string]*ArticleNode)
+	for _, article := range p.Server {
+		nodes[article.ID] = &ArticleNode{
+			ID:       article.ID,
+			Title:    article.Title,
+			Children: []*ArticleNode{},
+			Path:     p.Paths[article.ID],
 		}
-
-		// Index by ID if exists
-		if md.Frontmatter.ID != "" {
-			localByID[md.Frontmatter.ID] = md
-			localPaths[md.Frontmatter.ID] = filePath
-		} else {
-			// New file without ID - index by path
-			localByPath[filePath] = md
+	}
+	for _, update := range p.Updates {
+		node := nodes[update.ID]
+		node.Tags = update.Tags
+		node.Attachments = update.Attachments
+		if update.Changed() {
+			node.Status = StatusModified
 		}
 	}
-
-	// Index server articles
-	for i := range serverArticles {
-		serverByID[serverArticles[i].ID] = &serverArticles[i]
+	for _, rename := range p.Renames {
+		nodes[rename.ID].Notes = append(nodes[rename.ID].Notes, fmt.Sprintf("renamed to %q", rename.To))
 	}
-
-	// Build article status map
-	articleStatus := make(map[string]ArticleStatus)
-	articleTitles := make(map[string]string)
-	articlePaths := make(map[string]string)
-
-	// Check server articles
-	for id, article := range serverByID {
-		articleTitles[id] = article.Title
-		if localMD, exists := localByID[id]; exists {
-			// Article exists locally - check if modified
-			localContent := strings.TrimSpace(localMD.Content)
-			serverContent := strings.TrimSpace(article.Content)
-			if localContent != serverContent {
-				articleStatus[id] = StatusModified
-			} else {
-				articleStatus[id] = StatusUnchanged
-			}
-			if path, ok := localPaths[id]; ok {
-				articlePaths[id] = path
-			}
-		} else {
-			// Article on server but not local
-			articleStatus[id] = StatusDeleted
-		}
+	for _, move := range p.Moves {
+		nodes[move.ID].Notes = append(nodes[move.ID].Notes, fmt.Sprintf("moved from %s to %s",
+			parentTitle(p, move.From), parentTitle(p, move.To)))
 	}
-
-	// Note: New local articles (without ID) will be added to tree later
-
-	// Build tree structure from server articles
-	articlesByID := make(map[string]*api.Article)
-	for i := range serverArticles {
-		articlesByID[serverArticles[i].ID] = &serverArticles[i]
+	for _, deletion := range p.Deletions {
+		nodes[deletion.ID].Status = StatusDeleted
+	}
+	for _, download := range p.Downloads {
+		nodes[download.ID].Status = StatusNewServer
+	}
+	for _, conflict := range p.Conflicts {
+		if node, ok := nodes[conflict.ID]; ok {
+			node.Status = StatusConflict
+			node.Notes = append(node.Notes, "claimed by "+strings.Join(conflict.Paths, ", "))
+		}
 	}
 
-	// Find root articles
+	// Find root articles, including those whose parent is out of scope
 	var rootArticles []*api.Article
-	for i := range serverArticles {
-		if serverArticles[i].ParentID == nil || *serverArticles[i].ParentID == "" {
-			rootArticles = append(rootArticles, &serverArticles[i])
+	for i := range p.Server {
+		parentID := p.Server[i].ParentID
+		if parentID == nil || *parentID == "" || nodes[*parentID] == nil {
+			rootArticles = append(rootArticles, &p.Server[i])
 		}
 	}
 
@@ -137,22 +124,32 @@ func runDiff(cmd *cobra.Command, args []string) error {
 	// Build tree nodes
 	var rootNodes []*ArticleNode
 	for _, article := range rootArticles {
-		node := buildTreeNode(article, articlesByID, articleStatus, articleTitles, articlePaths)
-		rootNodes = append(rootNodes, node)
+		rootNodes = append(rootNodes, buildTreeNode(article, p.Server, nodes))
 	}
 
-	// Add new local articles (those without IDs) to the tree
-	// These should be added based on their file path location
-	for path, md := range localByPath {
-		// Determine parent from path
-		dir := filepath.Dir(path)
-		node := &ArticleNode{
-			ID:       "",
-			Title:    md.Frontmatter.Title,
+	// Add local files the server doesn't have, based on their location
+	var localOnly []*ArticleNode
+	for _, create := range p.Creates {
+		localOnly = append(localOnly, &ArticleNode{
+			ID:       create.ID,
+			Title:    create.Title,
 			Status:   StatusNewLocal,
 			Children: []*ArticleNode{},
-			Path:     path,
-		}
+			Path:     create.Path,
+		})
+	}
+	for _, orphan := range p.Orphans {
+		localOnly = append(localOnly, &ArticleNode{
+			ID:       orphan.ID,
+			Title:    orphan.Title,
+			Status:   StatusDeletedServer,
+			Children: []*ArticleNode{},
+			Path:     orphan.Path,
+			Notes:    []string{"deleted on server"},
+		})
+	}
+	for _, node := range localOnly {
+		dir := filepath.Dir(node.Path)
 
 		if dir == "." {
 			// Root level new article
@@ -178,30 +175,23 @@ func runDiff(cmd *cobra.Command, args []string) error {
 	fmt.Println("\nArticle Tree:")
 	displayTree(rootNodes, "", true)
 
+	if len(p.Invalid) > 0 {
+		fmt.Println("\nInvalid files:")
+		for _, invalid := range p.Invalid {
+			fmt.Printf("   %s: %v\n", invalid.Path, invalid.Err)
+		}
+	}
+
 	return nil
 }
 
-func buildTreeNode(
-	article *api.Article,
-	articlesByID map[string]*api.Article,
-	articleStatus map[string]ArticleStatus,
-	articleTitles map[string]string,
-	articlePaths map[string]string,
-) *ArticleNode {
-	node := &ArticleNode{
-		ID:       article.ID,
-		Title:    article.Title,
-		Status:   articleStatus[article.ID],
-		Children: []*ArticleNode{},
-	}
-	if path, ok := articlePaths[article.ID]; ok {
-		node.Path = path
-	}
+func buildTreeNode(article *api.Article, articles []api.Article, nodes map[string]*ArticleNode) *ArticleNode {
+	node := nodes[article.ID]
 
 	// Find children
 	var children []*api.Article
-	for i := range articlesByID {
-		child := articlesByID[i]
+	for i := range articles {
+		child := &articles[i]
 		if child.ParentID != nil && *child.ParentID == article.ID {
 			children = append(children, child)
 		}
@@ -214,21 +204,17 @@ func buildTreeNode(
 
 	// Build child nodes
 	for _, child := range children {
-		childNode := buildTreeNode(child, articlesByID, articleStatus, articleTitles, articlePaths)
-		node.Children = append(node.Children, childNode)
+		node.Children = append(node.Children, buildTreeNode(child, articles, nodes))
 	}
 
 	return node
 }
 
+// findNodeByPath finds the article whose folder is targetPath
 func findNodeByPath(nodes []*ArticleNode, targetPath string) *ArticleNode {
 	for _, node := range nodes {
-		if node.Path != "" {
-			// Check if this node's path matches
-			dir := filepath.Dir(node.Path)
-			if dir == targetPath {
-				return node
-			}
+		if node.Path != "" && strings.TrimSuffix(node.Path, ".md") == targetPath {
+			return node
 		}
 		// Recursively search children
 		if found := findNodeByPath(node.Children, targetPath); found != nil {
@@ -259,6 +245,12 @@ func displayTree(nodes []*ArticleNode, prefix string, isLast bool) {
 			icon = "❇️"
 		case StatusDeleted:
 			icon = "❌"
+		case StatusConflict:
+			icon = "⚠️"
+		case StatusNewServer:
+			icon = "⬇️"
+		case StatusDeletedServer:
+			icon = "🗑️"
 		default:
 			icon = " "
 		}
@@ -268,7 +260,23 @@ func displayTree(nodes []*ArticleNode, prefix string, isLast bool) {
 		if isLastChild {
 			connector = "└── "
 		}
-		fmt.Printf("%s%s%s %s\n", prefix, connector, icon, node.Title)
+		fmt.Printf("%s%s%s %s", prefix, connector, icon, node.Title)
+		if !node.Tags.Empty() {
+			fmt.Printf(" [tags %s]", node.Tags)
+		}
+		if len(node.Notes) > 0 {
+			fmt.Printf(" (%s)", strings.Join(node.Notes, "; "))
+		}
+		fmt.Println()
+
+		// Attachment changes come before the child articles
+		for j, change := range node.Attachments {
+			attachmentConnector := "├── "
+			if j == len(node.Attachments)-1 && len(node.Children) == 0 {
+				attachmentConnector = "└── "
+			}
+			fmt.Printf("%s%s%s\n", currentPrefix, attachmentConnector, change)
+		}
 
 		// Recursively display children
 		if len(node.Children) > 0 {
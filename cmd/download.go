@@ -2,29 +2,49 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 
 	"ytkb/internal/api"
+	"ytkb/internal/assets"
+	"ytkb/internal/content"
 	"ytkb/internal/filesystem"
+	"ytkb/internal/links"
 	"ytkb/internal/markdown"
+	"ytkb/internal/scope"
+	"ytkb/internal/state"
 
 	"github.com/spf13/cobra"
 )
 
+var downloadRecursive bool
+
 func downloadCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "download",
+	cmd := &cobra.Command{
+		Use:   "download [article...]",
 		Short: "Download all pages from knowledge base",
-		RunE:  runDownload,
+		Long: "Download all pages from the knowledge base, or only the given articles. Articles can be " +
+			"given by id, readable id such as KB-A-42, local file or title path such as Guides/Setup.",
+		PreRunE: loadConfig,
+		RunE:    perKB(runDownload),
 	}
+	cmd.Flags().BoolVarP(&downloadRecursive, "recursive", "r", false, "Also download the sub-articles of the given articles")
+	return cmd
 }
 
 func runDownload(cmd *cobra.Command, args []string) error {
 	fmt.Println("Downloading knowledge base articles...")
 
+	// Selected articles are fetched one by one, so only the tree is needed
 	client := api.NewClient(cfg)
-	articles, err := client.ListArticles()
+	list := client.ListArticles
+	if len(args) > 0 {
+		list = client.ListOutline
+	}
+	articles, err := list()
 	if err != nil {
 		return fmt.Errorf("failed to list articles: %w", err)
 	}
@@ -53,35 +73,299 @@ func runDownload(cmd *cobra.Command, args []string) error {
 		return rootArticles[i].Order < rootArticles[j].Order
 	})
 
-	fmt.Printf("Found %d root articles\n", len(rootArticles))
+	// Existing files keep their custom frontmatter keys when rewritten
+	existing, err := loadLocalFiles()
+	if err != nil {
+		return err
+	}
+
+	st, err := loadState()
+	if err != nil {
+		return err
+	}
 
-	// Download each root article and its children recursively
-	basePath := "."
+	d := &downloader{
+		client:       client,
+		articlesByID: articlesByID,
+		existing:     existing,
+		state:        st,
+		recursive:    true,
+	}
+
+	// Work out every article's path first, so links between them can be
+	// rewritten while downloading
+	var planned []links.Article
 	for _, rootArticle := range rootArticles {
-		if err := downloadArticleRecursive(rootArticle, basePath, articlesByID); err != nil {
+		planned = d.planPaths(rootArticle, ".", planned)
+	}
+
+	// A sparse workspace only ever sees the configured subtrees
+	sc, err := scope.New(cfg.Project.Roots, articles)
+	if err != nil {
+		return err
+	}
+	if sc != nil {
+		var scoped []links.Article
+		for _, article := range planned {
+			if sc.Contains(article.ID) {
+				scoped = append(scoped, article)
+			}
+		}
+		planned = scoped
+	}
+
+	if len(args) > 0 {
+		if err := d.downloadSelected(args, planned, sc); err != nil {
+			return err
+		}
+	} else if sc != nil {
+		fmt.Printf("Found %d workspace roots\n", len(sc.Roots))
+		if err := d.downloadTargets(sc.Roots, planned); err != nil {
+			return err
+		}
+
+		if err := reconcileOrphans(existing, articlesByID, st); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Found %d root articles\n", len(rootArticles))
+		d.converter = content.NewConverter(cfg.URL, st, planned)
+
+		// Download each root article and its children recursively
+		basePath := "."
+		for _, rootArticle := range rootArticles {
+			if err := d.downloadArticleRecursive(rootArticle, basePath); err != nil {
+				return err
+			}
+		}
+
+		if err := reconcileOrphans(existing, articlesByID, st); err != nil {
 			return err
 		}
 	}
 
-	fmt.Printf("Downloaded %d articles.\n", len(articles))
+	if err := st.Save("."); err != nil {
+		return err
+	}
+
+	fmt.Printf("Downloaded %d articles.\n", d.downloaded)
 	return nil
 }
 
+// downloadSelected downloads only the given articles, and their
+// descendants if --recursive is set, to where a full download puts them
+func (d *downloader) downloadSelected(args []string, planned []links.Article, sc *scope.Scope) error {
+	d.recursive = downloadRecursive
+	d.fetch = true
+
+	var targets []*api.Article
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		article, err := d.resolve(arg, planned)
+		if err != nil {
+			return err
+		}
+		if !sc.Contains(article.ID) {
+			return fmt.Errorf("%s is outside the workspace roots", arg)
+		}
+		if !seen[article.ID] {
+			seen[article.ID] = true
+			targets = append(targets, article)
+		}
+	}
+	return d.downloadTargets(targets, planned)
+}
+
+// downloadTargets downloads the given articles, and their descendants if
+// the downloader is recursive, to their planned paths
+func (d *downloader) downloadTargets(targets []*api.Article, planned []links.Article) error {
+	// Link to the files being written, and to other articles only where
+	// they already exist locally
+	selected := make(map[string]bool)
+	for _, target := range targets {
+		d.markSelected(target, selected)
+	}
+	var linked []links.Article
+	plannedPaths := make(map[string]string)
+	for _, article := range planned {
+		plannedPaths[article.ID] = article.Path
+		if local, ok := d.existing[article.ID]; ok && !selected[article.ID] {
+			article.Path = local.path
+		} else if !selected[article.ID] {
+			continue
+		}
+		linked = append(linked, article)
+	}
+	d.converter = content.NewConverter(cfg.URL, d.state, linked)
+
+	for _, target := range targets {
+		if err := d.downloadArticleRecursive(target, filepath.Dir(plannedPaths[target.ID])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markSelected records which articles a selective download writes
+func (d *downloader) markSelected(article *api.Article, selected map[string]bool) {
+	selected[article.ID] = true
+	if !d.recursive {
+		return
+	}
+	for _, child := range d.children(article) {
+		d.markSelected(child, selected)
+	}
+}
+
+// resolve finds the article an argument names: an id, a readable id, a
+// local file or a path of titles as download lays them out
+func (d *downloader) resolve(arg string, planned []links.Article) (*api.Article, error) {
+	if article, ok := d.articlesByID[arg]; ok {
+		return article, nil
+	}
+	for _, article := range d.articlesByID {
+		if article.IDReadable == arg {
+			return article, nil
+		}
+	}
+
+	path := filepath.Clean(arg)
+	if _, err := os.Stat(path); err == nil {
+		for id, local := range d.existing {
+			if filepath.Clean(local.path) == path {
+				if article, ok := d.articlesByID[id]; ok {
+					return article, nil
+				}
+				return nil, fmt.Errorf("article %s of %s not found on server", id, arg)
+			}
+		}
+	}
+
+	for _, article := range planned {
+		if path == article.Path || path == strings.TrimSuffix(article.Path, ".md") {
+			return d.articlesByID[article.ID], nil
+		}
+	}
+	return nil, fmt.Errorf("no article matches %s", arg)
+}
+
+// downloader holds what a download run shares between articles
+type downloader struct {
+	client       *api.Client
+	articlesByID map[string]*api.Article
+	existing     map[string]localFile
+	state        *state.State
+	converter    *content.Converter
+	// recursive downloads children along with their parent, fetch gets
+	// each article on its own instead of using the listed one
+	recursive  bool
+	fetch      bool
+	downloaded int
+}
+
+// planPaths lists where an article and its descendants will be written
+func (d *downloader) planPaths(article *api.Article, basePath string, planned []links.Article) []links.Article {
+	sanitizedTitle := filesystem.SanitizeFilename(article.Title)
+	planned = append(planned, links.Article{
+		ID:         article.ID,
+		IDReadable: article.IDReadable,
+		Path:       filepath.Join(basePath, sanitizedTitle+".md"),
+	})
+
+	for _, child := range d.children(article) {
+		planned = d.planPaths(child, filepath.Join(basePath, sanitizedTitle), planned)
+	}
+	return planned
+}
+
+// children returns an article's children in order
+func (d *downloader) children(article *api.Article) []*api.Article {
+	var children []*api.Article
+	for i := range d.articlesByID {
+		child := d.articlesByID[i]
+		if child.ParentID != nil && *child.ParentID == article.ID {
+			children = append(children, child)
+		}
+	}
+
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Order < children[j].Order
+	})
+	return children
+}
+
+// localFile is a markdown file already present in the workspace
+type localFile struct {
+	path string
+	md   *markdown.MarkdownFile
+}
+
+// loadLocalFiles indexes the workspace's markdown files by article ID
+func loadLocalFiles() (map[string]localFile, error) {
+	files, err := readWorkspace()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]localFile)
+	for _, file := range files {
+		if file.Err != nil || file.MD.Frontmatter.ID == "" {
+			continue
+		}
+		byID[file.MD.Frontmatter.ID] = localFile{path: file.Path, md: file.MD}
+	}
+
+	return byID, nil
+}
+
 // downloadArticleRecursive downloads an article and recursively downloads its children
-func downloadArticleRecursive(article *api.Article, basePath string, articlesByID map[string]*api.Article) error {
+func (d *downloader) downloadArticleRecursive(article *api.Article, basePath string) error {
+	if d.fetch {
+		fetched, err := d.client.GetArticle(article.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get article %s: %w", article.Title, err)
+		}
+		article = fetched
+	}
+
 	sanitizedTitle := filesystem.SanitizeFilename(article.Title)
 	filePath := filepath.Join(basePath, sanitizedTitle+".md")
 
 	fmt.Printf("Downloading: %s -> %s\n", article.Title, filePath)
 
-	// Save article
-	frontmatter := markdown.Frontmatter{
-		ID:    article.ID,
-		Title: article.Title,
-		URL:   article.URL,
+	// Update the existing file if there is one, so custom keys are kept
+	md := &markdown.MarkdownFile{}
+	if local, ok := d.existing[article.ID]; ok {
+		md = local.md
+		if local.path != filePath {
+			// The article was renamed or moved on the server
+			if err := os.Remove(local.path); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", local.path, err)
+			}
+			if err := moveAssets(local.path, filePath); err != nil {
+				return err
+			}
+			if err := d.moveChildren(local.path, filePath); err != nil {
+				return err
+			}
+			fmt.Printf("Moved: %s -> %s\n", local.path, filePath)
+		}
 	}
 
-	content, err := markdown.WriteMarkdown(frontmatter, article.Content)
+	// Save article
+	md.Frontmatter.ID = article.ID
+	md.Frontmatter.Title = article.Title
+	md.Frontmatter.URL = article.URL
+	md.Frontmatter.IDReadable = article.IDReadable
+	md.Frontmatter.Parent = article.ParentIDReadable
+	md.Frontmatter.Created = formatTime(article.Created)
+	md.Frontmatter.Reporter = article.Reporter
+	md.Frontmatter.Updated = formatTime(article.Updated)
+	md.Frontmatter.UpdatedBy = article.UpdatedBy
+	md.Frontmatter.SetTags(tagNames(article.Tags))
+	md.Content = d.converter.LocalContent(filePath, article)
+
+	content, err := md.Render()
 	if err != nil {
 		return fmt.Errorf("failed to write markdown: %w", err)
 	}
@@ -90,19 +374,21 @@ func downloadArticleRecursive(article *api.Article, basePath string, articlesByI
 		return fmt.Errorf("failed to write file %s: %w", filePath, err)
 	}
 
-	// Find all children of this article
-	var children []*api.Article
-	for i := range articlesByID {
-		child := articlesByID[i]
-		if child.ParentID != nil && *child.ParentID == article.ID {
-			children = append(children, child)
-		}
+	entry := d.state.Article(article.ID)
+	entry.Path = filePath
+	entry.IDReadable = article.IDReadable
+
+	if err := d.downloadAttachments(article, filePath); err != nil {
+		return err
 	}
 
-	// Sort children by order
-	sort.Slice(children, func(i, j int) bool {
-		return children[i].Order < children[j].Order
-	})
+	d.downloaded++
+	if !d.recursive {
+		return nil
+	}
+
+	// Find all children of this article
+	children := d.children(article)
 
 	// If there are children, create a folder and download them recursively
 	if len(children) > 0 {
@@ -110,7 +396,7 @@ func downloadArticleRecursive(article *api.Article, basePath string, articlesByI
 		fmt.Printf("Creating folder for %s: %s (with %d children)\n", article.Title, childDir, len(children))
 
 		for _, child := range children {
-			if err := downloadArticleRecursive(child, childDir, articlesByID); err != nil {
+			if err := d.downloadArticleRecursive(child, childDir); err != nil {
 				return err
 			}
 		}
@@ -118,3 +404,93 @@ func downloadArticleRecursive(article *api.Article, basePath string, articlesByI
 
 	return nil
 }
+
+// downloadAttachments saves an article's attachments next to it and records
+// them in the sync state. Unchanged local copies are not fetched again.
+func (d *downloader) downloadAttachments(article *api.Article, filePath string) error {
+	entry := d.state.Article(article.ID)
+	recorded := entry.Attachments
+	entry.Attachments = nil
+
+	for _, attachment := range article.Attachments {
+		path := assets.Path(filePath, attachment.Name)
+
+		if synced, ok := recorded[attachment.Name]; ok && synced.ID == attachment.ID {
+			if hash, err := assets.Hash(path); err == nil && hash == synced.Hash {
+				entry.SetAttachment(attachment.Name, synced)
+				continue
+			}
+		}
+
+		data, err := d.client.DownloadAttachment(attachment)
+		if err != nil {
+			return fmt.Errorf("failed to download attachment %s: %w", attachment.Name, err)
+		}
+		if err := filesystem.WriteFile(path, data); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", path, err)
+		}
+		entry.SetAttachment(attachment.Name, state.Attachment{
+			ID:   attachment.ID,
+			Hash: assets.HashBytes(data),
+			Size: int64(len(data)),
+		})
+	}
+
+	return nil
+}
+
+// moveAssets moves an article's attachments directory along with the article
+func moveAssets(oldPath, newPath string) error {
+	oldDir, newDir := assets.Dir(oldPath), assets.Dir(newPath)
+	if _, err := os.Stat(oldDir); os.IsNotExist(err) {
+		return nil
+	}
+	if err := filesystem.CreateDirectoryStructure(filepath.Dir(newDir)); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.Rename(oldDir, newDir); err != nil {
+		return fmt.Errorf("failed to move %s: %w", oldDir, err)
+	}
+	return nil
+}
+
+// moveChildren moves the folder of a renamed or moved article's
+// sub-articles along with it, so they are not left behind as orphans
+func (d *downloader) moveChildren(oldPath, newPath string) error {
+	oldDir, newDir := strings.TrimSuffix(oldPath, ".md"), strings.TrimSuffix(newPath, ".md")
+	if info, err := os.Stat(oldDir); err != nil || !info.IsDir() {
+		return nil
+	}
+	if _, err := os.Stat(newDir); err == nil {
+		fmt.Printf("Warning: %s already exists, sub-articles left in %s\n", newDir, oldDir)
+		return nil
+	}
+	if err := filesystem.CreateDirectoryStructure(filepath.Dir(newDir)); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.Rename(oldDir, newDir); err != nil {
+		return fmt.Errorf("failed to move %s: %w", oldDir, err)
+	}
+
+	// The sub-articles are now found in their new folder
+	prefix := oldDir + string(filepath.Separator)
+	for id, local := range d.existing {
+		if !strings.HasPrefix(local.path, prefix) {
+			continue
+		}
+		local.path = filepath.Join(newDir, strings.TrimPrefix(local.path, prefix))
+		d.existing[id] = local
+		if entry, ok := d.state.Articles[id]; ok {
+			entry.Path = local.path
+		}
+	}
+	return nil
+}
+
+// formatTime renders a timestamp for frontmatter, empty if unknown
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
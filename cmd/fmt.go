@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+
+	"ytkb/internal/filesystem"
+	"ytkb/internal/markdown"
+
+	"github.com/spf13/cobra"
+)
+
+var fmtCheck bool
+
+func fmtCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "fmt [page...]",
+		Short:        "Format local files the way YouTrack stores them",
+		Long:         "Rewrite article bodies in the canonical markdown form YouTrack stores, so formatting differences don't show up as changes. Formats all local files unless pages are given.",
+		SilenceUsage: true,
+		PreRunE:      loadLocalConfig,
+		RunE:         perKB(runFmt),
+	}
+	cmd.Flags().BoolVar(&fmtCheck, "check", false, "List files that need formatting without changing them")
+	return cmd
+}
+
+func runFmt(cmd *cobra.Command, args []string) error {
+	files := args
+	if len(files) == 0 {
+		var err error
+		files, err = filesystem.FindMarkdownFiles(".")
+		if err != nil {
+			return fmt.Errorf("failed to find local files: %w", err)
+		}
+	}
+
+	var changed []string
+	for _, filePath := range files {
+		content, err := filesystem.ReadMarkdownFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		md, err := markdown.ParseMarkdown(content, cfg.Project.LocalKeys...)
+		if err != nil {
+			fmt.Printf("Skipped %s: %v\n", filePath, err)
+			continue
+		}
+
+		formatted := md.Format()
+		if formatted == md.Content {
+			continue
+		}
+		changed = append(changed, filePath)
+		if fmtCheck {
+			fmt.Println(filePath)
+			continue
+		}
+
+		md.Content = formatted
+		newContent, err := md.Render()
+		if err != nil {
+			return fmt.Errorf("failed to write markdown: %w", err)
+		}
+		if err := filesystem.WriteMarkdownFile(filePath, newContent); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", filePath, err)
+		}
+		fmt.Printf("Formatted: %s\n", filePath)
+	}
+
+	if fmtCheck && len(changed) > 0 {
+		return fmt.Errorf("%d files need formatting", len(changed))
+	}
+	return nil
+}
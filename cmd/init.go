@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"ytkb/internal/api"
+	"ytkb/internal/config"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func initCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "init",
+		Short: "Set up the connection and knowledge base of this workspace",
+		Long: "Set up the connection to YouTrack in the global config and the knowledge base of this workspace " +
+			"in .env. Values come from --url, --token and --kb, or are asked for, and are checked against the " +
+			"server before anything is saved. Values from YTKB_URL, YTKB_TOKEN and YTKB_KB are checked but not saved.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runInit,
+	}
+}
+
+func runInit(cmd *cobra.Command, args []string) error {
+	local, err := config.LoadLocal(options)
+	if err != nil {
+		return err
+	}
+	profile := currentProfile()
+
+	current := make(map[string]string)
+	settings, err := config.GlobalSettings(profile)
+	if err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		current[setting.Key] = setting.Value
+	}
+
+	url, saveURL, err := initValue("YouTrack server URL", "--url", options.URL, config.URLEnv, current[config.KeyURL], false)
+	if err != nil {
+		return err
+	}
+	url = strings.TrimSuffix(url, "/")
+	if err := config.ValidateURL(url); err != nil {
+		return err
+	}
+	var token string
+	saveToken := false
+	if command := current[config.KeyTokenCommand]; command != "" && options.Token == "" && os.Getenv(config.TokenEnv) == "" {
+		fmt.Println("Using API token from token_command")
+		if token, err = config.RunTokenCommand(command); err != nil {
+			return err
+		}
+	} else if token, saveToken, err = initValue("API token", "--token", options.Token, config.TokenEnv, current[config.KeyToken], true); err != nil {
+		return err
+	}
+	if saveToken && current[config.KeyTokenCommand] != "" {
+		fmt.Println("The token is not saved, as token_command provides it")
+		saveToken = false
+	}
+
+	fmt.Printf("Checking connection to %s...\n", url)
+	bases, err := api.NewClient(&config.Config{URL: url, Token: token}).ListKnowledgeBases()
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", url, err)
+	}
+
+	changes := make(map[string]string)
+	if saveURL && url != current[config.KeyURL] {
+		changes[config.KeyURL] = url
+	}
+	if saveToken && token != current[config.KeyToken] {
+		changes[config.KeyToken] = token
+	}
+	if len(changes) > 0 {
+		if err := config.SetGlobal(profile, changes); err != nil {
+			return err
+		}
+		path, _ := config.ConfigPath()
+		fmt.Printf("Connection saved to %s\n", path)
+	}
+
+	// Multi-KB workspaces name their knowledge bases in ytkb.yaml
+	if kbs := local.Project.KnowledgeBases; len(kbs) > 0 {
+		for _, kb := range kbs {
+			if kb.Profile != "" && kb.Profile != profile {
+				continue
+			}
+			if _, ok := findKnowledgeBase(bases, kb.Key); !ok && len(bases) > 0 {
+				return fmt.Errorf("knowledge base %s of %s not found on %s", kb.Key, kb.Dir, url)
+			}
+		}
+		fmt.Printf("Workspace mirrors %d knowledge bases from %s.\n", len(kbs), config.ProjectFile)
+		return nil
+	}
+
+	existing, err := config.ReadKBKey()
+	if err != nil {
+		return err
+	}
+	key, saveKey, err := chooseKnowledgeBase(bases, existing)
+	if err != nil {
+		return err
+	}
+	if saveKey && key != existing {
+		if err := config.SetKBKey(key); err != nil {
+			return err
+		}
+		fmt.Printf("Knowledge base %s saved to %s\n", key, config.EnvFile)
+	}
+
+	fmt.Println("Workspace ready. Run `ytkb download` to fetch the articles.")
+	return nil
+}
+
+// currentProfile is the profile url and token are read from and saved to
+func currentProfile() string {
+	if options.Profile != "" {
+		return options.Profile
+	}
+	if profile := os.Getenv(config.ProfileEnv); profile != "" {
+		return profile
+	}
+	if local, err := config.LoadLocal(options); err == nil {
+		return local.Project.Profile
+	}
+	return ""
+}
+
+// initValue picks a setting from its flag, its environment variable or a
+// prompt, in that order. Only values from flags and prompts are saved.
+func initValue(label, flag, value, env, current string, secret bool) (string, bool, error) {
+	if value != "" {
+		return value, true, nil
+	}
+	if value := os.Getenv(env); value != "" {
+		fmt.Printf("Using %s from $%s\n", label, env)
+		return value, false, nil
+	}
+	value, err := ask(label, current, secret)
+	if err != nil {
+		return "", false, fmt.Errorf("%w: pass %s or set $%s", err, flag, env)
+	}
+	return value, true, nil
+}
+
+// ask prompts for a value. An empty answer keeps the current one, which is
+// also what non-interactive runs get.
+func ask(label, current string, secret bool) (string, error) {
+	if !interactive {
+		if current == "" {
+			return "", fmt.Errorf("%s is not set", label)
+		}
+		return current, nil
+	}
+
+	shown := current
+	if secret && current != "" {
+		shown = config.Mask(current)
+	}
+	if shown != "" {
+		fmt.Printf("%s [%s]: ", label, shown)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+	answer, err := readAnswer(secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", label, err)
+	}
+
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer, nil
+	}
+	if current == "" {
+		return "", fmt.Errorf("%s is required", label)
+	}
+	return current, nil
+}
+
+// readAnswer reads a line from stdin, without echoing secrets
+func readAnswer(secret bool) (string, error) {
+	if !secret {
+		return stdin.ReadString('\n')
+	}
+	answer, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	return string(answer), err
+}
+
+// chooseKnowledgeBase picks the workspace's knowledge base from --kb,
+// YTKB_KB or a list of those on the server, and checks it exists
+func chooseKnowledgeBase(bases []api.KnowledgeBase, current string) (string, bool, error) {
+	key, save := options.KB, true
+	if key == "" {
+		if key = os.Getenv(config.KBEnv); key != "" {
+			fmt.Printf("Using knowledge base %s from $%s\n", key, config.KBEnv)
+			save = false
+		}
+	}
+
+	if key == "" && interactive && len(bases) > 0 {
+		fmt.Println("\nAvailable knowledge bases:")
+		for i, kb := range bases {
+			fmt.Printf("  %d. %s (key: %s)\n", i+1, kb.Name, kb.Key)
+		}
+		fmt.Println()
+		answer, err := ask("Enter number or key", current, false)
+		if err != nil {
+			return "", false, err
+		}
+		key = answer
+		if num, err := strconv.Atoi(answer); err == nil && num > 0 && num <= len(bases) {
+			key = bases[num-1].Key
+		}
+	} else if key == "" {
+		answer, err := ask("Knowledge base key", current, false)
+		if err != nil {
+			return "", false, fmt.Errorf("%w: pass --kb or set $%s", err, config.KBEnv)
+		}
+		key = answer
+	}
+
+	if len(bases) == 0 {
+		fmt.Printf("Warning: could not list the knowledge bases on the server, %s was not checked\n", key)
+		return key, save, nil
+	}
+	if _, ok := findKnowledgeBase(bases, key); !ok {
+		var names []string
+		for _, kb := range bases {
+			names = append(names, fmt.Sprintf("%s (key: %s)", kb.Name, kb.Key))
+		}
+		return "", false, fmt.Errorf("knowledge base %s not found: use one of %s", key, strings.Join(names, ", "))
+	}
+	return key, save, nil
+}
+
+// findKnowledgeBase matches a key the way articles are matched to the
+// configured knowledge base, by key or name
+func findKnowledgeBase(bases []api.KnowledgeBase, key string) (api.KnowledgeBase, bool) {
+	for _, kb := range bases {
+		if kb.Key == key || kb.Name == key {
+			return kb, true
+		}
+	}
+	return api.KnowledgeBase{}, false
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ytkb/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// perKB runs a command in the directory of each knowledge base of a
+// multi-KB workspace, or only in the one chosen with --kb or YTKB_KB. File arguments
+// pick the knowledge base whose directory they are in. A failure in one
+// knowledge base doesn't stop the others.
+func perKB(run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		kbs := cfg.Project.KnowledgeBases
+		if len(kbs) == 0 {
+			return run(cmd, args)
+		}
+
+		selected, err := selectKBs(kbs, cfg.KBKey)
+		if err != nil {
+			return err
+		}
+		kbArgs, err := routeArgs(selected, args)
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, kb := range selected {
+			if len(args) > 0 && len(kbArgs[kb.Dir]) == 0 {
+				continue
+			}
+			if len(selected) > 1 {
+				fmt.Printf("\n== %s (%s) ==\n", kb.Key, kb.Dir)
+			}
+			if err := runInKB(kb, func() error { return run(cmd, kbArgs[kb.Dir]) }); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", kb.Key, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// selectKBs returns the knowledge base named by key or directory, or all
+// of them if name is empty
+func selectKBs(kbs []config.KBDir, name string) ([]config.KBDir, error) {
+	if name == "" {
+		return kbs, nil
+	}
+	for _, kb := range kbs {
+		if kb.Key == name || filepath.Clean(kb.Dir) == filepath.Clean(name) {
+			return []config.KBDir{kb}, nil
+		}
+	}
+	keys := make([]string, len(kbs))
+	for i, kb := range kbs {
+		keys[i] = kb.Key
+	}
+	return nil, fmt.Errorf("unknown knowledge base %s: use one of %s", name, strings.Join(keys, ", "))
+}
+
+// routeArgs assigns each argument to the knowledge base it belongs to.
+// Paths inside a knowledge base directory are made relative to it, other
+// existing files absolute. Anything else, such as an article id, needs a
+// single knowledge base.
+func routeArgs(kbs []config.KBDir, args []string) (map[string][]string, error) {
+	routed := make(map[string][]string)
+	for _, arg := range args {
+		kb, rel, ok := kbForPath(kbs, arg)
+		switch {
+		case ok:
+			routed[kb.Dir] = append(routed[kb.Dir], rel)
+		case len(kbs) == 1:
+			if _, err := os.Stat(arg); err == nil {
+				if abs, err := filepath.Abs(arg); err == nil {
+					arg = abs
+				}
+			}
+			routed[kbs[0].Dir] = append(routed[kbs[0].Dir], arg)
+		default:
+			return nil, fmt.Errorf("%s is not in a knowledge base directory: choose one with --kb", arg)
+		}
+	}
+	return routed, nil
+}
+
+func kbForPath(kbs []config.KBDir, path string) (config.KBDir, string, bool) {
+	path = filepath.Clean(path)
+	for _, kb := range kbs {
+		dir := filepath.Clean(kb.Dir)
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return kb, strings.TrimPrefix(path, dir+string(filepath.Separator)), true
+		}
+	}
+	return config.KBDir{}, "", false
+}
+
+// runInKB runs fn inside a knowledge base directory, with cfg pointing at
+// that knowledge base. Relative paths, such as ".", then refer to the
+// knowledge base, so arguments from the command line must be made relative
+// to it or absolute first.
+func runInKB(kb config.KBDir, fn func() error) (err error) {
+	kbCfg, err := cfg.ForKB(kb)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(kb.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", kb.Dir, err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+	if err := os.Chdir(kb.Dir); err != nil {
+		return fmt.Errorf("failed to enter %s: %w", kb.Dir, err)
+	}
+	// The next knowledge base must not start from this one
+	defer func() {
+		if cdErr := os.Chdir(wd); cdErr != nil && err == nil {
+			err = fmt.Errorf("failed to return to %s: %w", wd, cdErr)
+		}
+	}()
+
+	workspaceCfg := cfg
+	cfg = kbCfg
+	defer func() { cfg = workspaceCfg }()
+
+	return fn()
+}
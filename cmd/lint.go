@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"ytkb/internal/api"
+	"ytkb/internal/links"
+	"ytkb/internal/lint"
+	"ytkb/internal/plan"
+	"ytkb/internal/state"
+
+	"github.com/spf13/cobra"
+)
+
+var lintFormat string
+
+func lintCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "lint",
+		Short:        "Check local files for problems",
+		Long:         "Check local files for broken links, missing images, missing parents, empty or duplicate titles and duplicate ids. Nothing is changed.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		PreRunE:      loadLocalConfig,
+		RunE:         perKB(runLint),
+	}
+	cmd.Flags().StringVar(&lintFormat, "format", "text", "Output format: text or json")
+	return cmd
+}
+
+func runLint(cmd *cobra.Command, args []string) error {
+	if lintFormat != "text" && lintFormat != "json" {
+		return fmt.Errorf("unknown format %q: use text or json", lintFormat)
+	}
+
+	st, err := state.Load(".")
+	if err != nil {
+		return err
+	}
+
+	files, err := readWorkspace()
+	if err != nil {
+		return err
+	}
+	issues := lintWorkspace(st, nil, files)
+
+	if lintFormat == "json" {
+		if issues == nil {
+			issues = []lint.Issue{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(issues); err != nil {
+			return err
+		}
+	} else {
+		printIssues(issues)
+		if len(issues) == 0 {
+			fmt.Println("No problems found.")
+		}
+	}
+
+	// Warnings are reported but don't fail
+	if errors := lint.CountErrors(issues); errors > 0 {
+		return fmt.Errorf("lint found %d errors", errors)
+	}
+	return nil
+}
+
+// lintWorkspace checks every local file. Ids of the given server articles,
+// of local files and of the sync state count as existing articles.
+func lintWorkspace(st *state.State, serverArticles []api.Article, localFiles []plan.File) []lint.Issue {
+	known := make(map[string]bool)
+	for id, entry := range st.Articles {
+		known[id] = true
+		if entry.IDReadable != "" {
+			known[entry.IDReadable] = true
+		}
+	}
+	for _, article := range serverArticles {
+		known[article.ID] = true
+		if article.IDReadable != "" {
+			known[article.IDReadable] = true
+		}
+	}
+
+	files := make([]lint.File, 0, len(localFiles))
+	for _, local := range localFiles {
+		files = append(files, lint.File{Path: local.Path, MD: local.MD, Err: local.Err})
+		if local.Err != nil {
+			continue
+		}
+		if local.MD.Frontmatter.ID != "" {
+			known[local.MD.Frontmatter.ID] = true
+		}
+		if local.MD.Frontmatter.IDReadable != "" {
+			known[local.MD.Frontmatter.IDReadable] = true
+		}
+	}
+
+	linter := &lint.Linter{
+		Index: links.NewIndex(cfg.URL, nil),
+		Known: known,
+	}
+	return linter.Check(files)
+}
+
+// preflight runs lint before a push. Only issues in the given files are
+// reported, or in all files if none are given.
+func preflight(st *state.State, serverArticles []api.Article, files []plan.File, only ...string) error {
+	issues := lintWorkspace(st, serverArticles, files)
+
+	if len(only) > 0 {
+		wanted := make(map[string]bool)
+		for _, path := range only {
+			wanted[filepath.Clean(path)] = true
+		}
+		var filtered []lint.Issue
+		for _, issue := range issues {
+			if wanted[filepath.Clean(issue.Path)] {
+				filtered = append(filtered, issue)
+			}
+		}
+		issues = filtered
+	}
+
+	if len(issues) == 0 {
+		return nil
+	}
+
+	fmt.Println("\nLint:")
+	printIssues(issues)
+	if lint.HasErrors(issues) {
+		return fmt.Errorf("fix the lint errors above before pushing, or use --skip-lint")
+	}
+	return nil
+}
+
+func printIssues(issues []lint.Issue) {
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ytkb/internal/api"
+	"ytkb/internal/assets"
+	"ytkb/internal/config"
+	"ytkb/internal/state"
+)
+
+// orphanedDir keeps local files whose article was deleted on the server
+const orphanedDir = "orphaned"
+
+// reconcileOrphans handles local files whose article was synced before but
+// no longer exists on the server, as configured in ytkb.yaml
+func reconcileOrphans(existing map[string]localFile, articlesByID map[string]*api.Article, st *state.State) error {
+	var orphans []localFile
+	for id, local := range existing {
+		if _, onServer := articlesByID[id]; onServer {
+			continue
+		}
+		if _, synced := st.Articles[id]; synced {
+			orphans = append(orphans, local)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].path < orphans[j].path
+	})
+
+	for _, orphan := range orphans {
+		id := orphan.md.Frontmatter.ID
+
+		switch cfg.Project.Orphaned {
+		case config.OrphanedMove:
+			target, err := orphanPath(orphan.path, id)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+			if err := os.Rename(orphan.path, target); err != nil {
+				return fmt.Errorf("failed to move %s: %w", orphan.path, err)
+			}
+			if err := moveAssets(orphan.path, target); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted on server, moved: %s -> %s\n", orphan.path, target)
+
+		case config.OrphanedDelete:
+			if err := os.Remove(orphan.path); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", orphan.path, err)
+			}
+			if err := os.RemoveAll(assets.Dir(orphan.path)); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", assets.Dir(orphan.path), err)
+			}
+			fmt.Printf("Deleted on server, removed: %s\n", orphan.path)
+
+		default:
+			fmt.Printf("⚠️  Deleted on server: %s\n", orphan.path)
+			continue
+		}
+
+		delete(st.Articles, id)
+		// Drop the article's folder if nothing else is left in it
+		os.Remove(strings.TrimSuffix(orphan.path, ".md"))
+	}
+
+	if len(orphans) > 0 && cfg.Project.Orphaned != config.OrphanedMove && cfg.Project.Orphaned != config.OrphanedDelete {
+		fmt.Printf("   Set orphaned: move or orphaned: delete in %s to clean these up on download.\n", config.ProjectFile)
+	}
+	return nil
+}
+
+// orphanPath is where an orphaned file is kept, without replacing an
+// earlier orphan of the same name
+func orphanPath(path, id string) (string, error) {
+	target := filepath.Join(state.Dir, orphanedDir, path)
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		return target, nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(target, ".md") + "." + id + ".md", nil
+}
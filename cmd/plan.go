@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"ytkb/internal/api"
+	"ytkb/internal/compare"
+	"ytkb/internal/plan"
+	"ytkb/internal/scope"
+	"ytkb/internal/state"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	planOut        string
+	planFormat     bool
+	planCreateTags bool
+	planPrune      bool
+	planSkipLint   bool
+	planDelete     bool
+	planRecursive  bool
+	planArchive    bool
+)
+
+func planCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show what push would change",
+		Long: "Show what push would change without changing anything. With --out, the plan is saved " +
+			"so that `ytkb apply` can push exactly these changes later.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		PreRunE:      planOutPath,
+		RunE:         perKB(runPlan),
+	}
+	cmd.Flags().StringVarP(&planOut, "out", "o", "", "Save the plan to a file")
+	cmd.Flags().BoolVar(&planFormat, "fmt", false, "Ignore differences that formatting would remove")
+	cmd.Flags().BoolVar(&planCreateTags, "create-tags", false, "Create tags that don't exist in YouTrack yet")
+	cmd.Flags().BoolVar(&planPrune, "prune-attachments", false, "Remove server attachments no longer referenced by their article")
+	cmd.Flags().BoolVar(&planSkipLint, "skip-lint", false, "Plan even if lint finds errors")
+	cmd.Flags().BoolVar(&planDelete, "delete", false, "Delete server articles whose local file was deleted")
+	cmd.Flags().BoolVar(&planRecursive, "recursive", false, "With --delete, also delete articles that have sub-articles")
+	cmd.Flags().BoolVar(&planArchive, "archive", false, "Move server articles whose local file was deleted to the archive article")
+	return cmd
+}
+
+// planOutPath loads the configuration and keeps --out relative to where ytkb was run, as plans of a
+// multi-KB workspace are made inside the knowledge base's directory
+func planOutPath(cmd *cobra.Command, args []string) error {
+	if err := loadConfig(cmd, args); err != nil {
+		return err
+	}
+	if planOut == "" || len(cfg.Project.KnowledgeBases) == 0 {
+		return nil
+	}
+	if len(cfg.Project.KnowledgeBases) > 1 && cfg.KBKey == "" {
+		return fmt.Errorf("a plan covers one knowledge base: choose one with --kb")
+	}
+	out, err := filepath.Abs(planOut)
+	if err != nil {
+		return err
+	}
+	planOut = out
+	return nil
+}
+
+func runPlan(cmd *cobra.Command, args []string) error {
+	if planDelete && planArchive {
+		return fmt.Errorf("--delete and --archive can't be combined")
+	}
+
+	client := api.NewClient(cfg)
+	allArticles, err := client.ListArticles()
+	if err != nil {
+		return fmt.Errorf("failed to list server articles: %w", err)
+	}
+
+	st, err := loadState()
+	if err != nil {
+		return err
+	}
+
+	serverArticles, files, err := scopeWorkspace(allArticles)
+	if err != nil {
+		return err
+	}
+
+	if !planSkipLint {
+		if err := preflight(st, serverArticles, files); err != nil {
+			return err
+		}
+	}
+
+	opts := plan.Options{
+		Format:     planFormat,
+		CreateTags: planCreateTags,
+		Prune:      planPrune,
+		Delete:     planDelete,
+		Recursive:  planRecursive,
+		Archive:    planArchive,
+	}
+	p := newPlanner(st, planFormat).Plan(files, serverArticles)
+	pages := p.Pushable(planPrune)
+	deletions, err := selectRemovals(p, allArticles, opts)
+	if err != nil {
+		return err
+	}
+
+	resolver := newTagResolver(client, planCreateTags)
+	if len(pages) == 0 && len(deletions) == 0 {
+		fmt.Println("No changes to push.")
+	}
+	if len(pages) > 0 {
+		printUpdates(p, pages, planPrune)
+		if err := resolver.check(tagDiffs(pages)...); err != nil {
+			return err
+		}
+	}
+	if len(deletions) > 0 && planArchive {
+		printArchives(deletions)
+	} else if len(deletions) > 0 {
+		printDeletions(deletions)
+	}
+	warnSkipped(p)
+
+	saved, err := savePlan(p, resolver, opts, deletions, files)
+	if err != nil {
+		return err
+	}
+	if len(saved.NewTags) > 0 {
+		fmt.Printf("\nTags to be created: %s\n", strings.Join(saved.NewTags, ", "))
+	}
+
+	if planOut == "" {
+		return nil
+	}
+	if err := saved.Write(planOut); err != nil {
+		return err
+	}
+	fmt.Printf("\nSaved plan to %s. Push it with: ytkb apply %s\n", planOut, planOut)
+	return nil
+}
+
+// savePlan records everything applying a plan does: the article updates,
+// the articles deleted or archived and the tags created
+func savePlan(p *plan.Plan, resolver *tagResolver, opts plan.Options, deletions []deletion, files []plan.File) (*plan.Saved, error) {
+	saved := p.Save(cfg.URL, cfg.KBKey, opts, files)
+	saved.Removals = removals(deletions)
+	if opts.CreateTags {
+		newTags, err := resolver.missing(tagDiffs(p.Pushable(opts.Prune))...)
+		if err != nil {
+			return nil, err
+		}
+		saved.NewTags = newTags
+	}
+	return saved, nil
+}
+
+// compareRules returns the configured comparison rules. format forces
+// comparing in canonical markdown form.
+func compareRules(format bool) compare.Rules {
+	rules := cfg.Project.Compare
+	if format {
+		rules.Format = true
+	}
+	return rules
+}
+
+// readWorkspace reads every local markdown file
+func readWorkspace() ([]plan.File, error) {
+	return plan.ReadFiles(".", cfg.Project.LocalKeys...)
+}
+
+// scopeWorkspace reads the local files and limits them and the server
+// articles to the roots configured in ytkb.yaml
+func scopeWorkspace(articles []api.Article) ([]api.Article, []plan.File, error) {
+	sc, err := scope.New(cfg.Project.Roots, articles)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files, err := readWorkspace()
+	if err != nil {
+		return nil, nil, err
+	}
+	return sc.Articles(articles), scopeFiles(sc, files), nil
+}
+
+// scopeFiles drops local files that belong to articles outside the scope
+// or lie outside the roots' folders
+func scopeFiles(sc *scope.Scope, files []plan.File) []plan.File {
+	if sc == nil {
+		return files
+	}
+	var scoped []plan.File
+	for _, file := range files {
+		if file.Err == nil && file.MD.Frontmatter.ID != "" && sc.Contains(file.MD.Frontmatter.ID) {
+			scoped = append(scoped, file)
+		} else if sc.ContainsPath(file.Path) {
+			scoped = append(scoped, file)
+		}
+	}
+	return scoped
+}
+
+// newPlanner compares local files with the server using the configured
+// rules. format forces comparing in canonical markdown form.
+func newPlanner(st *state.State, format bool) *plan.Planner {
+	return &plan.Planner{
+		BaseURL: cfg.URL,
+		State:   st,
+		Rules:   compareRules(format),
+	}
+}
+
+// parentTitle names a parent article for messages
+func parentTitle(p *plan.Plan, id string) string {
+	if id == "" {
+		return "top level"
+	}
+	return p.Title(id)
+}
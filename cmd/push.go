@@ -2,30 +2,62 @@ package cmd
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"ytkb/internal/api"
 	"ytkb/internal/filesystem"
 	"ytkb/internal/markdown"
+	"ytkb/internal/plan"
+	"ytkb/internal/scope"
+	"ytkb/internal/state"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	pushCreateTags       bool
+	pushPruneAttachments bool
+	pushSkipLint         bool
+	pushFormat           bool
+	pushDelete           bool
+	pushRecursive        bool
+	pushArchive          bool
+)
+
+// stdin is shared by every prompt, so answers piped in together all arrive
+var stdin = bufio.NewReader(os.Stdin)
+
 func pushCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "push [page]",
-		Short: "Push changes to server",
-		Long:  "Push changes to server. If page is specified, push that page. Otherwise, push all changes.",
-		Args:  cobra.MaximumNArgs(1),
-		RunE:  runPush,
+		Use:     "push [page]",
+		Short:   "Push changes to server",
+		Long:    "Push changes to server. If page is specified, push that page. Otherwise, push all changes.",
+		Args:    cobra.MaximumNArgs(1),
+		PreRunE: loadConfig,
+		RunE:    perKB(runPush),
 	}
+	cmd.Flags().BoolVar(&pushCreateTags, "create-tags", false, "Create tags that don't exist in YouTrack yet")
+	cmd.Flags().BoolVar(&pushPruneAttachments, "prune-attachments", false, "Remove server attachments no longer referenced by their article")
+	cmd.Flags().BoolVar(&pushSkipLint, "skip-lint", false, "Push even if lint finds errors")
+	cmd.Flags().BoolVar(&pushFormat, "fmt", false, "Ignore differences that formatting would remove")
+	cmd.Flags().BoolVar(&pushDelete, "delete", false, "Delete server articles whose local file was deleted")
+	cmd.Flags().BoolVar(&pushRecursive, "recursive", false, "With --delete, also delete articles that have sub-articles")
+	cmd.Flags().BoolVar(&pushArchive, "archive", false, "Move server articles whose local file was deleted to the archive article")
 	return cmd
 }
 
 func runPush(cmd *cobra.Command, args []string) error {
+	if pushDelete && pushArchive {
+		return fmt.Errorf("--delete and --archive can't be combined")
+	}
 	if len(args) > 0 {
+		if pushDelete || pushArchive {
+			return fmt.Errorf("--delete and --archive only work when pushing all changes")
+		}
 		return pushSinglePage(args[0])
 	}
 	return pushAllChanges()
@@ -33,172 +65,402 @@ func runPush(cmd *cobra.Command, args []string) error {
 
 func pushSinglePage(filePath string) error {
 	fmt.Printf("Pushing %s...\n", filePath)
+	filePath = filepath.Clean(filePath)
 
 	content, err := filesystem.ReadMarkdownFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
-	md, err := markdown.ParseMarkdown(content)
+	md, err := markdown.ParseMarkdown(content, cfg.Project.LocalKeys...)
 	if err != nil {
 		return fmt.Errorf("failed to parse markdown: %w", err)
 	}
 
-	client := api.NewClient(cfg)
-
 	// Check if article exists
 	if md.Frontmatter.ID == "" {
 		return fmt.Errorf("cannot push article without ID: %s. Articles must be created manually in YouTrack first", md.Frontmatter.Title)
 	}
 
-	// Update existing article
-	_, err = client.UpdateArticle(md.Frontmatter.ID, md.Frontmatter.Title, md.Content)
+	st, err := loadState()
+	if err != nil {
+		return err
+	}
+
+	// Only this article is compared, so only this article is fetched
+	client := api.NewClient(cfg)
+	article, err := client.GetArticle(md.Frontmatter.ID)
+	if errors.Is(err, api.ErrNotFound) {
+		if _, synced := st.Articles[md.Frontmatter.ID]; synced {
+			return fmt.Errorf("article %s was deleted on the server", md.Frontmatter.ID)
+		}
+		return fmt.Errorf("article %s not found on server", md.Frontmatter.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get article: %w", err)
+	}
+	serverArticles := []api.Article{*article}
+
+	if len(cfg.Project.Roots) > 0 {
+		outline, err := client.ListOutline()
+		if err != nil {
+			return fmt.Errorf("failed to list server articles: %w", err)
+		}
+		sc, err := scope.New(cfg.Project.Roots, outline)
+		if err != nil {
+			return err
+		}
+		if !sc.Contains(article.ID) {
+			return fmt.Errorf("%s is outside the workspace roots", article.Title)
+		}
+	}
+
+	files, err := readWorkspace()
 	if err != nil {
-		return fmt.Errorf("failed to update article: %w", err)
+		return err
+	}
+
+	if !pushSkipLint {
+		if err := preflight(st, serverArticles, files, filePath); err != nil {
+			return err
+		}
+	}
+
+	p := newPlanner(st, pushFormat).Plan(files, serverArticles)
+
+	for _, conflict := range p.Conflicts {
+		for _, path := range conflict.Paths {
+			if filepath.Clean(path) == filePath {
+				return fmt.Errorf("article %s is claimed by several files: %s", conflict.ID, strings.Join(conflict.Paths, ", "))
+			}
+		}
+	}
+	for _, move := range p.Moves {
+		if filepath.Clean(move.Path) == filePath {
+			fmt.Printf("⚠️  %s is under %s on the server, moving is not supported\n", move.Title, parentTitle(p, move.From))
+		}
+	}
+
+	var update plan.Update
+	found := false
+	for _, candidate := range p.Updates {
+		if filepath.Clean(candidate.Path) == filePath {
+			update, found = candidate, true
+			break
+		}
+	}
+	if !found {
+		fmt.Println("No changes to push.")
+		return nil
+	}
+
+	resolver := newTagResolver(client, pushCreateTags)
+	if err := resolver.check(update.Tags); err != nil {
+		return err
+	}
+
+	// Confirm pruning before changing anything
+	prune := false
+	if prunable := update.Prunable(); pushPruneAttachments && len(prunable) > 0 {
+		var names []string
+		for _, change := range prunable {
+			names = append(names, change.Name)
+		}
+		fmt.Printf("Attachments to remove: %s\n", strings.Join(names, ", "))
+		if prune, err = confirm("Remove these attachments?"); err != nil {
+			return err
+		}
 	}
-	fmt.Printf("Updated: %s\n", md.Frontmatter.Title)
 
+	if !update.Changed() && !prune {
+		fmt.Println("No changes to push.")
+		return nil
+	}
+
+	if err := applyUpdate(client, st, resolver, update, prune); err != nil {
+		return err
+	}
+	fmt.Printf("Updated: %s\n", update.Title)
+
+	return st.Save(".")
+}
+
+// applyUpdate pushes a planned update: attachments first, so the content
+// that references them never points to missing files
+func applyUpdate(client *api.Client, st *state.State, resolver *tagResolver, update plan.Update, prune bool) error {
+	if update.Modified || update.Renamed {
+		if err := pushAttachments(client, st, update.ID, update.Attachments); err != nil {
+			return err
+		}
+		if _, err := client.UpdateArticle(update.ID, update.Title, update.Content); err != nil {
+			return fmt.Errorf("failed to update article: %w", err)
+		}
+	}
+	if err := resolver.apply(update.ID, update.Tags); err != nil {
+		return err
+	}
+	if prune {
+		if err := pruneAttachments(client, st, update.ID, update.Attachments); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func pushAllChanges() error {
-	// Get diff
-	localFiles, err := filesystem.FindMarkdownFiles(".")
+// confirm asks a yes/no question on stdin, defaulting to no
+func confirm(question string) (bool, error) {
+	if !interactive {
+		return false, errNoPrompt(question)
+	}
+	fmt.Printf("\n%s (y/N): ", question)
+	response, err := stdin.ReadString('\n')
 	if err != nil {
-		return fmt.Errorf("failed to find local files: %w", err)
+		return false, fmt.Errorf("failed to read response: %w", err)
 	}
 
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes", nil
+}
+
+// errNoPrompt explains why ytkb cannot ask a question
+func errNoPrompt(question string) error {
+	return fmt.Errorf("cannot ask %q: ytkb is not running interactively", question)
+}
+
+func pushAllChanges() error {
 	client := api.NewClient(cfg)
-	serverArticles, err := client.ListArticles()
+	allArticles, err := client.ListArticles()
 	if err != nil {
 		return fmt.Errorf("failed to list server articles: %w", err)
 	}
 
-	// Build maps
-	localByID := make(map[string]*markdown.MarkdownFile)
-	localPaths := make(map[string]string)
-	serverByID := make(map[string]*api.Article)
+	st, err := loadState()
+	if err != nil {
+		return err
+	}
 
-	for _, filePath := range localFiles {
-		content, err := filesystem.ReadMarkdownFile(filePath)
-		if err != nil {
-			continue
-		}
+	serverArticles, files, err := scopeWorkspace(allArticles)
+	if err != nil {
+		return err
+	}
 
-		md, err := markdown.ParseMarkdown(content)
-		if err != nil {
-			continue
+	if !pushSkipLint {
+		if err := preflight(st, serverArticles, files); err != nil {
+			return err
 		}
+	}
 
-		if md.Frontmatter.ID != "" {
-			localByID[md.Frontmatter.ID] = md
-			localPaths[md.Frontmatter.ID] = filePath
-		}
+	p := newPlanner(st, pushFormat).Plan(files, serverArticles)
+
+	pagesToPush := p.Pushable(pushPruneAttachments)
+
+	// Articles deleted locally are removed from the server, or archived
+	// with their sub-articles
+	deletions, err := selectRemovals(p, allArticles, plan.Options{Delete: pushDelete, Recursive: pushRecursive, Archive: pushArchive})
+	if err != nil {
+		return err
 	}
+	removing := pushDelete || pushArchive
 
-	for i := range serverArticles {
-		serverByID[serverArticles[i].ID] = &serverArticles[i]
+	if len(pagesToPush) == 0 && len(deletions) == 0 {
+		warnSkipped(p)
+		if !removing {
+			warnDeleted(p)
+		}
+		fmt.Println("No changes to push.")
+		return nil
 	}
 
-	// Collect pages to push (modified)
-	var pagesToPush []struct {
-		id       string
-		title    string
-		filePath string
+	// Resolve tag names before asking, so unknown tags fail early
+	resolver := newTagResolver(client, pushCreateTags)
+	if len(pagesToPush) > 0 {
+		printUpdates(p, pagesToPush, pushPruneAttachments)
+		if err := resolver.check(tagDiffs(pagesToPush)...); err != nil {
+			return err
+		}
+	}
+	if len(deletions) > 0 && pushArchive {
+		printArchives(deletions)
+	} else if len(deletions) > 0 {
+		printDeletions(deletions)
 	}
 
-	for id, localMD := range localByID {
-		if serverArticle, ok := serverByID[id]; ok {
-			localContent := strings.TrimSpace(localMD.Content)
-			serverContent := strings.TrimSpace(serverArticle.Content)
+	warnSkipped(p)
 
-			if localContent != serverContent {
-				filePath := localPaths[id]
-				pagesToPush = append(pagesToPush, struct {
-					id       string
-					title    string
-					filePath string
-				}{id: id, title: localMD.Frontmatter.Title, filePath: filePath})
-			}
+	// Ask for confirmation
+	if len(pagesToPush) > 0 {
+		proceed, err := confirm("Proceed with push?")
+		if err != nil {
+			return err
+		}
+		if !proceed {
+			fmt.Println("Push cancelled.")
+			return nil
 		}
 	}
 
-	// Skip new pages (cannot create articles)
-	var newPages []string
-	for _, filePath := range localFiles {
-		content, err := filesystem.ReadMarkdownFile(filePath)
+	// Deleting needs its own, deliberate confirmation
+	count := 0
+	for _, d := range deletions {
+		count += d.count()
+	}
+	if count > 0 && pushArchive {
+		proceed, err := confirm(fmt.Sprintf("Archive %d articles?", len(deletions)))
 		if err != nil {
-			continue
+			return err
 		}
-
-		md, err := markdown.ParseMarkdown(content)
+		if !proceed {
+			fmt.Println("Archiving cancelled.")
+			deletions = nil
+		}
+	} else if count > 0 {
+		proceed, err := confirmCount(count)
 		if err != nil {
-			continue
+			return err
 		}
+		if !proceed {
+			fmt.Println("Deletion cancelled.")
+			deletions = nil
+		}
+	}
 
-		// New page (no ID) or not on server
-		_, existsOnServer := serverByID[md.Frontmatter.ID]
-		isNew := md.Frontmatter.ID == "" || !existsOnServer
-		if isNew {
-			newPages = append(newPages, filePath)
+	// Every step runs, and the state is saved, even if some articles fail
+	var failures []string
+	if len(pagesToPush) > 0 {
+		if failed := executeUpdates(client, st, resolver, pagesToPush, pushPruneAttachments); failed > 0 {
+			failures = append(failures, fmt.Sprintf("push %d of %d articles", failed, len(pagesToPush)))
+		}
+	}
+	if len(deletions) > 0 && pushArchive {
+		if failed := archiveArticles(client, st, allArticles, deletions); failed > 0 {
+			failures = append(failures, fmt.Sprintf("archive %d of %d articles", failed, len(deletions)))
+		}
+	} else if len(deletions) > 0 {
+		if failed := deleteArticles(client, st, deletions); failed > 0 {
+			failures = append(failures, fmt.Sprintf("delete %d of %d articles", failed, len(deletions)))
 		}
 	}
 
-	// Show what will be pushed
-	if len(pagesToPush) == 0 && len(newPages) == 0 {
-		fmt.Println("No changes to push.")
-		return nil
+	if err := st.Save("."); err != nil {
+		return err
+	}
+
+	if !removing {
+		warnDeleted(p)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to %s", strings.Join(failures, " and "))
 	}
 
+	fmt.Println("\nPush complete.")
+	return nil
+}
+
+// printUpdates lists the pages a push sends and the attachments it could
+// remove
+func printUpdates(p *plan.Plan, pages []plan.Update, prune bool) {
 	fmt.Println("\nPages to be pushed:")
-	if len(pagesToPush) > 0 {
-		for i, page := range pagesToPush {
-			fmt.Printf("  %d. %s (%s)\n", i+1, page.title, page.filePath)
+	for i, page := range pages {
+		fmt.Printf("  %d. %s (%s)", i+1, page.Title, page.Path)
+		if page.Renamed {
+			fmt.Printf(" [renamed from %q]", page.Article.Title)
+		}
+		if !page.Tags.Empty() {
+			fmt.Printf(" [tags %s]", page.Tags)
+		}
+		fmt.Println()
+		for _, change := range page.Attachments {
+			if change.Upload() {
+				fmt.Printf("       %s\n", change)
+			}
+		}
+	}
+
+	var prunable []plan.AttachmentChange
+	for _, update := range p.Updates {
+		prunable = append(prunable, update.Prunable()...)
+	}
+	if len(prunable) > 0 {
+		if prune {
+			fmt.Printf("\nAttachments to be removed from the server:\n")
+		} else {
+			fmt.Printf("\n%d attachments are no longer used (remove them with --prune-attachments):\n", len(prunable))
+		}
+		for _, change := range prunable {
+			fmt.Printf("   %s\n", change)
+		}
+	}
+}
+
+// executeUpdates pushes pages one by one and returns how many failed
+func executeUpdates(client *api.Client, st *state.State, resolver *tagResolver, pages []plan.Update, prune bool) int {
+	fmt.Println("\nPushing changes...")
+	failed := 0
+	for _, page := range pages {
+		if err := applyUpdate(client, st, resolver, page, prune); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to update %s: %v\n", page.Title, err)
+			failed++
+			continue
 		}
+		fmt.Printf("Updated: %s\n", page.Title)
 	}
+	return failed
+}
+
+func tagDiffs(pages []plan.Update) []plan.TagDiff {
+	diffs := make([]plan.TagDiff, 0, len(pages))
+	for _, page := range pages {
+		diffs = append(diffs, page.Tags)
+	}
+	return diffs
+}
 
-	if len(newPages) > 0 {
-		fmt.Printf("\n⚠️  Skipped %d new articles (creation not supported):\n", len(newPages))
-		for _, path := range newPages {
-			fmt.Printf("   %s\n", path)
+// warnSkipped lists the planned changes push can't make
+func warnSkipped(p *plan.Plan) {
+	if len(p.Creates) > 0 {
+		fmt.Printf("\n⚠️  Skipped %d new articles (creation not supported):\n", len(p.Creates))
+		for _, create := range p.Creates {
+			fmt.Printf("   %s\n", create.Path)
 		}
 		fmt.Println("   Create these articles manually in YouTrack first, then download to get their IDs.")
 	}
 
-	// Ask for confirmation
-	fmt.Print("\nProceed with push? (y/N): ")
-	reader := bufio.NewReader(os.Stdin)
-	response, err := reader.ReadString('\n')
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+	if len(p.Orphans) > 0 {
+		fmt.Printf("\n⚠️  Skipped %d articles deleted on the server:\n", len(p.Orphans))
+		for _, orphan := range p.Orphans {
+			fmt.Printf("   %s\n", orphan.Path)
+		}
+		fmt.Println("   Run download to clean them up.")
 	}
 
-	response = strings.TrimSpace(strings.ToLower(response))
-	if response != "y" && response != "yes" {
-		fmt.Println("Push cancelled.")
-		return nil
+	if len(p.Moves) > 0 {
+		fmt.Printf("\n⚠️  Skipped %d moved articles (moving not supported):\n", len(p.Moves))
+		for _, move := range p.Moves {
+			fmt.Printf("   %s: under %s on the server, %s locally\n", move.Path, parentTitle(p, move.From), parentTitle(p, move.To))
+		}
+		fmt.Println("   Move these articles in YouTrack, then download.")
 	}
 
-	// Process modified pages (update)
-	fmt.Println("\nPushing changes...")
-	for _, page := range pagesToPush {
-		localMD := localByID[page.id]
-		_, err := client.UpdateArticle(page.id, localMD.Frontmatter.Title, localMD.Content)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to update %s: %v\n", page.title, err)
-			continue
+	if len(p.Conflicts) > 0 {
+		fmt.Printf("\n⚠️  Skipped %d articles claimed by several files:\n", len(p.Conflicts))
+		for _, conflict := range p.Conflicts {
+			fmt.Printf("   %s: %s\n", conflict.ID, strings.Join(conflict.Paths, ", "))
 		}
-		fmt.Printf("Updated: %s\n", page.title)
 	}
 
-	// Process deleted pages (warn only)
-	for id, article := range serverByID {
-		if _, exists := localByID[id]; !exists {
-			fmt.Printf("⚠️  Page deleted locally: %s\n", article.Title)
-			fmt.Printf("   Delete manually at: %s\n", article.URL)
+	if len(p.Invalid) > 0 {
+		fmt.Printf("\n⚠️  Skipped %d files that could not be read:\n", len(p.Invalid))
+		for _, invalid := range p.Invalid {
+			fmt.Printf("   %s: %v\n", invalid.Path, invalid.Err)
 		}
 	}
+}
 
-	fmt.Println("\nPush complete.")
-	return nil
+// warnDeleted lists server articles whose local file was deleted. They are
+// never deleted automatically.
+func warnDeleted(p *plan.Plan) {
+	for _, deletion := range p.Deletions {
+		fmt.Printf("⚠️  Page deleted locally: %s\n", deletion.Title)
+		fmt.Printf("   Delete it with push --delete, or manually at: %s\n", deletion.URL)
+	}
 }
@@ -1,14 +1,29 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	"ytkb/internal/config"
+	"ytkb/internal/state"
 )
 
-var cfg *config.Config
+var (
+	cfg *config.Config
+	// options override the configuration files, see config.Options
+	options        config.Options
+	nonInteractive bool
+	// interactive is false when ytkb must not prompt, because of
+	// --non-interactive or because stdin is not a terminal
+	interactive bool
+)
 
-func Execute(c *config.Config) error {
-	cfg = c
+func Execute() error {
+	cobra.OnInitialize(func() {
+		interactive = !nonInteractive && stdinIsTerminal()
+	})
 
 	rootCmd := &cobra.Command{
 		Use:   "youtrack_writer",
@@ -16,9 +31,67 @@ func Execute(c *config.Config) error {
 		Long:  "A CLI tool to download, diff, and push YouTrack knowledge base articles",
 	}
 
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&options.KB, "kb", "", "Knowledge base to work on, or one of a multi-KB workspace (default $"+config.KBEnv+")")
+	flags.StringVar(&options.Profile, "profile", "", "Connect with this profile of config.ini (default $"+config.ProfileEnv+")")
+	flags.StringVar(&options.URL, "url", "", "YouTrack server URL (default $"+config.URLEnv+")")
+	flags.StringVar(&options.Token, "token", "", "API token; prefer $"+config.TokenEnv+", as flags are visible to other users")
+	flags.BoolVar(&nonInteractive, "non-interactive", false, "Fail instead of prompting (default when stdin is not a terminal)")
+
+	rootCmd.AddCommand(initCmd())
+	rootCmd.AddCommand(configCmd())
 	rootCmd.AddCommand(downloadCmd())
 	rootCmd.AddCommand(diffCmd())
 	rootCmd.AddCommand(pushCmd())
+	rootCmd.AddCommand(planCmd())
+	rootCmd.AddCommand(applyCmd())
+	rootCmd.AddCommand(restoreCmd())
+	rootCmd.AddCommand(lintCmd())
+	rootCmd.AddCommand(fmtCmd())
 
 	return rootCmd.Execute()
 }
+
+// loadConfig is the PreRunE of commands that talk to the server. Other
+// commands, help and completion run without any configuration.
+func loadConfig(cmd *cobra.Command, args []string) error {
+	c, err := config.Load(options)
+	if err != nil {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	cfg = c
+	if cfg.Profile != "" {
+		fmt.Fprintf(os.Stderr, "Using profile %s (%s)\n", cfg.Profile, cfg.URL)
+	}
+	return nil
+}
+
+// loadLocalConfig is the PreRunE of offline commands
+func loadLocalConfig(cmd *cobra.Command, args []string) error {
+	c, err := config.LoadLocal(options)
+	if err != nil {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	cfg = c
+	return nil
+}
+
+// loadState reads the sync state of the workspace. Its article ids only
+// mean something on the server they were synced with.
+func loadState() (*state.State, error) {
+	st, err := state.Load(".")
+	if err != nil {
+		return nil, err
+	}
+	if st.URL != "" && len(st.Articles) > 0 && !sameURL(st.URL, cfg.URL) {
+		return nil, fmt.Errorf("this workspace was synced with %s, not %s: use the profile it was synced with", st.URL, cfg.URL)
+	}
+	st.URL = cfg.URL
+	return st, nil
+}
+
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
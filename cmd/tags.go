@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ytkb/internal/api"
+	"ytkb/internal/plan"
+)
+
+// tagNames returns the names of an article's tags for frontmatter
+func tagNames(tags []api.Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tagResolver maps tag names to server tags, creating missing ones if allowed.
+// Server tags are only listed once a tag actually needs to be added.
+type tagResolver struct {
+	client *api.Client
+	byName map[string]api.Tag
+	create bool
+}
+
+func newTagResolver(client *api.Client, create bool) *tagResolver {
+	return &tagResolver{client: client, create: create}
+}
+
+func (r *tagResolver) load() error {
+	if r.byName != nil {
+		return nil
+	}
+
+	tags, err := r.client.ListTags()
+	if err != nil {
+		return fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	r.byName = make(map[string]api.Tag)
+	for _, tag := range tags {
+		r.byName[tag.Name] = tag
+	}
+	return nil
+}
+
+// check fails on tag names that don't exist on the server, unless they may
+// be created.
+func (r *tagResolver) check(diffs ...plan.TagDiff) error {
+	if r.create {
+		return nil
+	}
+	unknown, err := r.missing(diffs...)
+	if err != nil || len(unknown) == 0 {
+		return err
+	}
+	return fmt.Errorf("unknown tags: %s (create them in YouTrack or use --create-tags)", strings.Join(unknown, ", "))
+}
+
+// missing lists the added tag names that don't exist on the server yet
+func (r *tagResolver) missing(diffs ...plan.TagDiff) ([]string, error) {
+	unknown := make(map[string]bool)
+	for _, diff := range diffs {
+		for _, name := range diff.Add {
+			if err := r.load(); err != nil {
+				return nil, err
+			}
+			if _, ok := r.byName[name]; !ok {
+				unknown[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(unknown))
+	for name := range unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// apply adds and removes tags on an article
+func (r *tagResolver) apply(articleID string, diff plan.TagDiff) error {
+	for _, name := range diff.Add {
+		if err := r.load(); err != nil {
+			return err
+		}
+		tag, ok := r.byName[name]
+		if !ok {
+			if !r.create {
+				return fmt.Errorf("unknown tag: %s", name)
+			}
+			created, err := r.client.CreateTag(name)
+			if err != nil {
+				return fmt.Errorf("failed to create tag %s: %w", name, err)
+			}
+			fmt.Printf("Created tag: %s\n", name)
+			tag = *created
+			r.byName[name] = tag
+		}
+		if err := r.client.AddArticleTag(articleID, tag.ID); err != nil {
+			return fmt.Errorf("failed to add tag %s: %w", name, err)
+		}
+	}
+
+	for _, tag := range diff.Remove {
+		if err := r.client.RemoveArticleTag(articleID, tag.ID); err != nil {
+			return fmt.Errorf("failed to remove tag %s: %w", tag.Name, err)
+		}
+	}
+
+	return nil
+}
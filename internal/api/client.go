@@ -3,10 +3,14 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	neturl "net/url"
 	"strings"
+	"time"
 	"ytkb/internal/config"
 )
 
@@ -34,8 +38,54 @@ type Article struct {
 	ParentID *string `json:"parentId,omitempty"`
 	Order    int     `json:"order"`
 	URL      string  `json:"url"`
+
+	// Read-only metadata, only filled in by ListArticles and GetArticle
+	IDReadable       string    `json:"idReadable,omitempty"`
+	ParentIDReadable string    `json:"parentIdReadable,omitempty"`
+	Created          time.Time `json:"created"`
+	Updated          time.Time `json:"updated"`
+	Reporter         string    `json:"reporter,omitempty"`
+	UpdatedBy        string    `json:"updatedBy,omitempty"`
+	Tags             []Tag     `json:"tags,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+type Attachment struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+type Tag struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// user is the subset of a YouTrack user returned with articles
+type user struct {
+	Login string `json:"login"`
 }
 
+func (u *user) login() string {
+	if u == nil {
+		return ""
+	}
+	return u.Login
+}
+
+// fromMillis converts a YouTrack timestamp, in milliseconds since the epoch
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
+
+// ListKnowledgeBases lists the knowledge bases the token can see. Older
+// servers without /api/knowledgeBases get the projects of their articles.
 func (c *Client) ListKnowledgeBases() ([]KnowledgeBase, error) {
 	// Ensure URL doesn't have trailing slash
 	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
@@ -54,6 +104,9 @@ func (c *Client) ListKnowledgeBases() ([]KnowledgeBase, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		return c.listArticleProjects()
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
@@ -67,87 +120,130 @@ func (c *Client) ListKnowledgeBases() ([]KnowledgeBase, error) {
 	return bases, nil
 }
 
-func (c *Client) ListArticles() ([]Article, error) {
+// listArticleProjects lists the projects that have articles, as knowledge
+// bases keyed by project id
+func (c *Client) listArticleProjects() ([]KnowledgeBase, error) {
 	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
-
-	// Fallback: Use /api/articles and filter client-side
-	// The KBKey might be a project ID or project name
-	// Fetch all articles and filter by project client-side since query syntax varies
-	// Include parent field to preserve hierarchy (try both parentId and parent)
-	url := fmt.Sprintf("%s/api/articles?fields=id,summary,content,parentArticle(id),project(id,name)&$top=1000", baseURL)
-
-	req, err := http.NewRequest("GET", url, nil)
+	articles, err := getAll[articleResponse](c, fmt.Sprintf("%s/api/articles?fields=project(id,name)", baseURL))
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request to %s: %w", url, err)
+	var bases []KnowledgeBase
+	seen := make(map[string]bool)
+	for _, article := range articles {
+		if article.Project.ID != "" && !seen[article.Project.ID] {
+			seen[article.Project.ID] = true
+			bases = append(bases, KnowledgeBase{Key: article.Project.ID, Name: article.Project.Name})
+		}
 	}
-	defer resp.Body.Close()
+	return bases, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
+// articleFields is the field selection requested for every article
+const articleFields = "id,idReadable,summary,content,created,updated,reporter(login),updatedBy(login)," +
+	"parentArticle(id,idReadable),project(id,name),tags(id,name)," +
+	"attachments(" + attachmentFields + ")"
+
+// outlineFields is enough to place articles in the tree, without content
+const outlineFields = "id,idReadable,summary,parentArticle(id,idReadable),project(id,name)"
+
+const attachmentFields = "id,name,url,size,mimeType"
+
+// ErrNotFound is returned for articles that don't exist in the knowledge base
+var ErrNotFound = errors.New("not found")
+
+// articleResponse is an article as the REST API returns it
+type articleResponse struct {
+	ID         string `json:"id"`
+	IDReadable string `json:"idReadable"`
+	Summary    string `json:"summary"`
+	Content    string `json:"content"`
+	Created    int64  `json:"created"`
+	Updated    int64  `json:"updated"`
+	Reporter   *user  `json:"reporter"`
+	UpdatedBy  *user  `json:"updatedBy"`
+	Parent     *struct {
+		ID         string `json:"id"`
+		IDReadable string `json:"idReadable"`
+	} `json:"parentArticle,omitempty"`
+	Project struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"project"`
+	Tags        []Tag        `json:"tags"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+// inKB reports whether the article belongs to the configured knowledge
+// base. KBKey might be a project ID or name.
+func (c *Client) inKB(ar *articleResponse) bool {
+	return c.cfg.KBKey == "" || ar.Project.ID == c.cfg.KBKey || ar.Project.Name == c.cfg.KBKey
+}
+
+func (ar *articleResponse) article(baseURL string) Article {
+	// Extract parent ID from the parent object
+	var parentID *string
+	var parentIDReadable string
+	if ar.Parent != nil && ar.Parent.ID != "" {
+		parentID = &ar.Parent.ID
+		parentIDReadable = ar.Parent.IDReadable
 	}
 
-	// Parse articles response
-	type ArticleResponse struct {
-		ID      string `json:"id"`
-		Summary string `json:"summary"`
-		Content string `json:"content"`
-		Parent  *struct {
-			ID string `json:"id"`
-		} `json:"parentArticle,omitempty"`
-		Project struct {
-			ID   string `json:"id"`
-			Name string `json:"name"`
-		} `json:"project"`
+	return Article{
+		ID:               ar.ID,
+		Title:            ar.Summary,
+		Content:          ar.Content,
+		ParentID:         parentID, // Preserve parent relationship
+		Order:            0,        // Order might not be available in this endpoint
+		URL:              fmt.Sprintf("%s/articles/%s", baseURL, ar.ID),
+		IDReadable:       ar.IDReadable,
+		ParentIDReadable: parentIDReadable,
+		Created:          fromMillis(ar.Created),
+		Updated:          fromMillis(ar.Updated),
+		Reporter:         ar.Reporter.login(),
+		UpdatedBy:        ar.UpdatedBy.login(),
+		Tags:             ar.Tags,
+		Attachments:      ar.Attachments,
 	}
+}
 
-	var articleResponses []ArticleResponse
-	if err := json.NewDecoder(resp.Body).Decode(&articleResponses); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+func (c *Client) ListArticles() ([]Article, error) {
+	return c.listArticles(articleFields)
+}
+
+// ListOutline lists articles without their content, tags or attachments
+func (c *Client) ListOutline() ([]Article, error) {
+	return c.listArticles(outlineFields)
+}
+
+func (c *Client) listArticles(fields string) ([]Article, error) {
+	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
+
+	// Fallback: Use /api/articles and filter client-side
+	// The KBKey might be a project ID or project name
+	// Fetch all articles and filter by project client-side since query syntax varies
+	articleResponses, err := getAll[articleResponse](c, fmt.Sprintf("%s/api/articles?fields=%s", baseURL, fields))
+	if err != nil {
+		return nil, err
 	}
 
 	// Convert to Article format and filter by KBKey if needed
 	articles := make([]Article, 0)
-	for _, ar := range articleResponses {
-		// If KBKey is specified, only include articles from that project
-		// Check both ID and name in case KBKey is a name
-		if c.cfg.KBKey != "" {
-			if ar.Project.ID != c.cfg.KBKey && ar.Project.Name != c.cfg.KBKey {
-				continue
-			}
+	for i := range articleResponses {
+		if c.inKB(&articleResponses[i]) {
+			articles = append(articles, articleResponses[i].article(baseURL))
 		}
-
-		// Extract parent ID from either parentId field or parent object
-		var parentID *string
-		if ar.Parent != nil && ar.Parent.ID != "" {
-			parentID = &ar.Parent.ID
-		}
-
-		article := Article{
-			ID:       ar.ID,
-			Title:    ar.Summary,
-			Content:  ar.Content,
-			ParentID: parentID, // Preserve parent relationship
-			Order:    0,        // Order might not be available in this endpoint
-			URL:      fmt.Sprintf("%s/articles/%s", baseURL, ar.ID),
-		}
-		articles = append(articles, article)
 	}
 
 	return articles, nil
 }
 
+// GetArticle fetches a single article by id or readable id, with the same
+// fields as ListArticles
 func (c *Client) GetArticle(articleID string) (*Article, error) {
 	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
-	url := fmt.Sprintf("%s/api/knowledgeBases/%s/articles/%s", baseURL, c.cfg.KBKey, articleID)
+	url := fmt.Sprintf("%s/api/articles/%s?fields=%s", baseURL, neturl.PathEscape(articleID), articleFields)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -162,16 +258,23 @@ func (c *Client) GetArticle(articleID string) (*Article, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("article %s %w", articleID, ErrNotFound)
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
 	}
 
-	var article Article
-	if err := json.NewDecoder(resp.Body).Decode(&article); err != nil {
-		return nil, err
+	var ar articleResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ar); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if !c.inKB(&ar) {
+		return nil, fmt.Errorf("article %s %w in this knowledge base", articleID, ErrNotFound)
 	}
 
+	article := ar.article(baseURL)
 	return &article, nil
 }
 
@@ -229,7 +332,7 @@ func (c *Client) UpdateArticle(articleID, title, content string) (*Article, erro
 	url := fmt.Sprintf("%s/api/articles/%s", baseURL, articleID)
 
 	payload := map[string]interface{}{
-		"title":   title,
+		"summary": title,
 		"content": content,
 	}
 
@@ -265,3 +368,312 @@ func (c *Client) UpdateArticle(articleID, title, content string) (*Article, erro
 
 	return &article, nil
 }
+
+// MoveArticle makes an article a sub-article of parentID, or a top-level
+// article if parentID is empty
+func (c *Client) MoveArticle(articleID, parentID string) error {
+	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
+	url := fmt.Sprintf("%s/api/articles/%s", baseURL, articleID)
+
+	var parent interface{}
+	if parentID != "" {
+		parent = map[string]interface{}{"id": parentID}
+	}
+	jsonData, err := json.Marshal(map[string]interface{}{"parentArticle": parent})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// DeleteArticle deletes an article
+func (c *Client) DeleteArticle(articleID string) error {
+	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
+	url := fmt.Sprintf("%s/api/articles/%s", baseURL, articleID)
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+func (c *Client) ListTags() ([]Tag, error) {
+	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
+	return getAll[Tag](c, fmt.Sprintf("%s/api/tags?fields=id,name", baseURL))
+}
+
+// pageSize is how many items list requests fetch at a time
+const pageSize = 1000
+
+// getAll fetches every page of a list. url must already have a query.
+func getAll[T any](c *Client, url string) ([]T, error) {
+	var all []T
+	for skip := 0; ; skip += pageSize {
+		pageURL := fmt.Sprintf("%s&$skip=%d&$top=%d", url, skip, pageSize)
+		req, err := http.NewRequest("GET", pageURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make request to %s: %w", pageURL, err)
+		}
+
+		var page []T
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			err = fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
+		} else if decodeErr := json.NewDecoder(resp.Body).Decode(&page); decodeErr != nil {
+			err = fmt.Errorf("failed to decode response: %w", decodeErr)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		// A short page is the last one
+		all = append(all, page...)
+		if len(page) < pageSize {
+			return all, nil
+		}
+	}
+}
+
+func (c *Client) CreateTag(name string) (*Tag, error) {
+	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
+	url := fmt.Sprintf("%s/api/tags?fields=id,name", baseURL)
+
+	jsonData, err := json.Marshal(map[string]interface{}{"name": name})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var tag Tag
+	if err := json.NewDecoder(resp.Body).Decode(&tag); err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+func (c *Client) AddArticleTag(articleID, tagID string) error {
+	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
+	url := fmt.Sprintf("%s/api/articles/%s/tags", baseURL, articleID)
+
+	jsonData, err := json.Marshal(map[string]interface{}{"id": tagID})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+func (c *Client) RemoveArticleTag(articleID, tagID string) error {
+	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
+	url := fmt.Sprintf("%s/api/articles/%s/tags/%s", baseURL, articleID, tagID)
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// DownloadAttachment fetches the content of an attachment
+func (c *Client) DownloadAttachment(attachment Attachment) ([]byte, error) {
+	// Attachment URLs are relative to the server root
+	base, err := neturl.Parse(c.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := neturl.Parse(attachment.URL)
+	if err != nil {
+		return nil, err
+	}
+	url := base.ResolveReference(ref).String()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// UploadAttachment adds a file to an article's attachments
+func (c *Client) UploadAttachment(articleID, name string, data []byte) ([]Attachment, error) {
+	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
+	url := fmt.Sprintf("%s/api/articles/%s/attachments?fields=%s", baseURL, articleID, attachmentFields)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile(name, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", url, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var attachments []Attachment
+	if err := json.NewDecoder(resp.Body).Decode(&attachments); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+func (c *Client) DeleteAttachment(articleID, attachmentID string) error {
+	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
+	url := fmt.Sprintf("%s/api/articles/%s/attachments/%s", baseURL, articleID, attachmentID)
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API error: %d - %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultTitle is the archive article's title if none is configured
+const DefaultTitle = "Archive"
+
+// Settings configure where archived articles go and how they are marked
+type Settings struct {
+	// Title of the top-level article archived articles are moved under
+	Title string `yaml:"title,omitempty"`
+	// Prefix is added to archived articles' titles, Tag to their tags
+	Prefix string `yaml:"prefix,omitempty"`
+	Tag    string `yaml:"tag,omitempty"`
+}
+
+// ArticleTitle returns the configured archive article title
+func (s Settings) ArticleTitle() string {
+	if s.Title == "" {
+		return DefaultTitle
+	}
+	return s.Title
+}
+
+// marker records the parent an archived article came from, empty for the
+// top level. It is an HTML comment so YouTrack doesn't render it.
+var marker = regexp.MustCompile(`\n*<!-- ytkb:archived-from=([^ ]*) -->\n?`)
+
+// Mark records an article's original parent in its content
+func Mark(content, parentID string) string {
+	content, _, _ = Unmark(content)
+	return strings.TrimRight(content, "\n") + "\n\n<!-- ytkb:archived-from=" + parentID + " -->\n"
+}
+
+// Unmark removes the archive marker from content and returns the original
+// parent it recorded. ok is false if the content has no marker.
+func Unmark(content string) (string, string, bool) {
+	m := marker.FindStringSubmatchIndex(content)
+	if m == nil {
+		return content, "", false
+	}
+	parentID := content[m[2]:m[3]]
+	rest := content[:m[0]] + content[m[1]:]
+	if !strings.HasSuffix(rest, "\n") && rest != "" {
+		rest += "\n"
+	}
+	return rest, parentID, true
+}
+
+// ArchivedTitle adds the configured prefix to a title
+func (s Settings) ArchivedTitle(title string) string {
+	if s.Prefix == "" || strings.HasPrefix(title, s.Prefix) {
+		return title
+	}
+	return s.Prefix + title
+}
+
+// RestoredTitle removes the configured prefix from a title
+func (s Settings) RestoredTitle(title string) string {
+	return strings.TrimPrefix(title, s.Prefix)
+}
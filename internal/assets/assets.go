@@ -0,0 +1,247 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ytkb/internal/markdown"
+)
+
+// Suffix is appended to an article's file name, without ".md", to name the
+// directory holding its attachments.
+const Suffix = ".assets"
+
+// Dir returns the attachments directory of an article file
+func Dir(mdPath string) string {
+	return strings.TrimSuffix(mdPath, ".md") + Suffix
+}
+
+// FileName is the name an attachment is stored under in the assets
+// directory, with characters that can't appear in file names replaced
+func FileName(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "<", "_", ">", "_", ":", "_",
+		"\"", "_", "|", "_", "?", "_", "*", "_").Replace(name)
+}
+
+// Path is where an article's attachment is stored locally
+func Path(mdPath, name string) string {
+	return filepath.Join(Dir(mdPath), FileName(name))
+}
+
+// Existing is an attachment already on the server. Hash is empty when its
+// content is unknown.
+type Existing struct {
+	Name string
+	Hash string
+}
+
+// Upload is a local file referenced by an article that is not yet one of
+// its attachments
+type Upload struct {
+	Path string
+	Name string
+	Hash string
+}
+
+// Hash returns the SHA-256 of a file's content, hex encoded
+func Hash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashBytes returns the SHA-256 of data, hex encoded
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// prefix is how the assets directory is written at the start of a link
+// target. Angle-bracketed targets may contain spaces, others are escaped.
+func prefix(mdPath string, angle bool) string {
+	name := filepath.Base(Dir(mdPath))
+	if !angle {
+		name = url.PathEscape(name)
+	}
+	return name + "/"
+}
+
+// decode returns the file name a link target refers to
+func decode(target string, angle bool) string {
+	if angle {
+		return target
+	}
+	if decoded, err := url.PathUnescape(target); err == nil {
+		return decoded
+	}
+	return target
+}
+
+// isExternal reports whether a target points outside the workspace
+func isExternal(target string) bool {
+	return target == "" ||
+		strings.Contains(target, "://") ||
+		strings.HasPrefix(target, "mailto:") ||
+		strings.HasPrefix(target, "#") ||
+		strings.HasPrefix(target, "/")
+}
+
+// ToLocal points references to the named attachments at the files they
+// are stored as in the article's assets directory. Names that are valid
+// file names are kept exactly as written, so ToServer restores the
+// original text.
+func ToLocal(content, mdPath string, names []string) string {
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[name] = true
+	}
+
+	return markdown.RewriteLinks(content, func(link markdown.Link) string {
+		name := decode(link.Target, link.Angle)
+		if isExternal(link.Target) || !known[name] {
+			return link.Target
+		}
+		file := FileName(name)
+		switch {
+		case file == name:
+			file = link.Target
+		case !link.Angle:
+			file = url.PathEscape(file)
+		}
+		return prefix(mdPath, link.Angle) + file
+	})
+}
+
+// ToServer turns references into the assets directory, and to other local
+// files, back into attachment names. Referenced files that are not among
+// the existing attachments are returned as uploads, unless their content is
+// identical to an existing attachment or another upload, in which case the
+// reference is pointed at that one instead. Files from outside the assets
+// directory are named after themselves, with a number added when another
+// attachment already has that name.
+func ToServer(content, mdPath string, existing []Existing) (string, []Upload) {
+	known := make(map[string]bool, len(existing))
+	byFile := make(map[string]string, len(existing))
+	byHash := make(map[string]string)
+	for _, attachment := range existing {
+		known[attachment.Name] = true
+		byFile[FileName(attachment.Name)] = attachment.Name
+		if attachment.Hash != "" {
+			byHash[attachment.Hash] = attachment.Name
+		}
+	}
+
+	// taken reports whether name belongs to an attachment, or to a file in
+	// the assets directory, other than path
+	taken := func(name, path string) bool {
+		if known[name] {
+			return true
+		}
+		own := Path(mdPath, name)
+		_, err := os.Stat(own)
+		return err == nil && filepath.Clean(path) != own
+	}
+	// free returns name, or the first numbered variant of it not taken
+	free := func(name, path string) string {
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for i := 2; taken(name, path); i++ {
+			name = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+		return name
+	}
+
+	var uploads []Upload
+	// queue decides which attachment a local file ends up as. Files in
+	// the assets directory keep their name, others get a free one.
+	queue := func(path, name string, own bool) string {
+		if own && known[name] {
+			return name
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			// Missing files are left as they are
+			return name
+		}
+		hash, err := Hash(path)
+		if err != nil {
+			return name
+		}
+		if same, ok := byHash[hash]; ok {
+			return same
+		}
+		if !own {
+			name = free(name, path)
+		}
+		known[name] = true
+		byHash[hash] = name
+		uploads = append(uploads, Upload{Path: path, Name: name, Hash: hash})
+		return name
+	}
+
+	// target writes an attachment name back as a link target
+	target := func(name, written string, angle bool) string {
+		if decode(written, angle) == name {
+			return written
+		}
+		if angle {
+			return name
+		}
+		return url.PathEscape(name)
+	}
+
+	rewritten := markdown.RewriteLinks(content, func(link markdown.Link) string {
+		if isExternal(link.Target) {
+			return link.Target
+		}
+
+		// Reference into the article's own assets directory
+		if rest, ok := strings.CutPrefix(link.Target, prefix(mdPath, link.Angle)); ok {
+			file := decode(rest, link.Angle)
+			name, ok := byFile[file]
+			if !ok {
+				name = file
+			}
+			return target(queue(filepath.Join(Dir(mdPath), file), name, true), rest, link.Angle)
+		}
+
+		// Any other local file becomes a new attachment named after it
+		path := decode(link.Target, link.Angle)
+		if strings.HasSuffix(path, ".md") {
+			return link.Target
+		}
+		path = filepath.Join(filepath.Dir(mdPath), filepath.FromSlash(path))
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			return link.Target
+		}
+		return target(queue(path, filepath.Base(path), false), "", link.Angle)
+	})
+
+	return rewritten, uploads
+}
+
+// References returns the names of the local files or attachments a body
+// refers to
+func References(content string) map[string]bool {
+	names := make(map[string]bool)
+	for _, link := range markdown.Links(content) {
+		if !isExternal(link.Target) {
+			names[decode(link.Target, link.Angle)] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,64 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"ytkb/internal/api"
+	"ytkb/internal/assets"
+	"ytkb/internal/filesystem"
+	"ytkb/internal/state"
+)
+
+// dirName holds one directory of backups per run, inside the state directory
+const dirName = "deleted"
+
+// Record is a deleted article as it was on the server
+type Record struct {
+	Article api.Article `json:"article"`
+	// Path is the local file the article was last synced to
+	Path    string    `json:"path,omitempty"`
+	Deleted time.Time `json:"deleted"`
+}
+
+// Backup is where the articles deleted by one run are kept
+type Backup struct {
+	dir string
+}
+
+// New creates a backup for articles deleted now, in the workspace at basePath
+func New(basePath string, now time.Time) *Backup {
+	return &Backup{dir: filepath.Join(basePath, state.Dir, dirName, now.UTC().Format("20060102-150405"))}
+}
+
+// Dir is the directory the backup is written to
+func (b *Backup) Dir() string {
+	return b.dir
+}
+
+// Save writes an article and the content of its attachments, keyed by name
+func (b *Backup) Save(record Record, attachments map[string][]byte) error {
+	name := record.Article.IDReadable
+	if name == "" {
+		name = record.Article.ID
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(b.dir, name+".json")
+	if err := filesystem.WriteFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", record.Article.Title, err)
+	}
+
+	for attachment, content := range attachments {
+		path := filepath.Join(b.dir, name+".assets", assets.FileName(attachment))
+		if err := filesystem.WriteFile(path, content); err != nil {
+			return fmt.Errorf("failed to back up attachment %s: %w", attachment, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package compare
+
+import (
+	"regexp"
+	"strings"
+
+	"ytkb/internal/markdown"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Rules select which differences between local and server content are
+// ignored. The zero value is strict: only leading and trailing whitespace
+// of the whole body is ignored.
+type Rules struct {
+	// LineEndings treats CRLF and LF as equal
+	LineEndings bool `yaml:"line_endings,omitempty"`
+	// TrailingWhitespace ignores spaces and tabs at the end of lines
+	TrailingWhitespace bool `yaml:"trailing_whitespace,omitempty"`
+	// UnicodeNFC compares text in Unicode normalization form C
+	UnicodeNFC bool `yaml:"unicode_nfc,omitempty"`
+	// BlankLines treats runs of blank lines as a single one
+	BlankLines bool `yaml:"blank_lines,omitempty"`
+	// Format compares content in the canonical form of markdown.Format
+	Format bool `yaml:"format,omitempty"`
+}
+
+var (
+	trailingWhitespace = regexp.MustCompile(`[ \t]+(\r?\n|$)`)
+	blankLines         = regexp.MustCompile(`(\r?\n)(?:[ \t]*\r?\n)+`)
+)
+
+// Normalize applies the rules to content
+func Normalize(content string, rules Rules) string {
+	if rules.Format {
+		// Formatting also normalizes line endings and trailing whitespace
+		content = markdown.Format(content)
+	}
+	if rules.LineEndings {
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	if rules.TrailingWhitespace {
+		content = trailingWhitespace.ReplaceAllString(content, "$1")
+	}
+	if rules.BlankLines {
+		content = blankLines.ReplaceAllString(content, "$1$1")
+	}
+	if rules.UnicodeNFC {
+		content = norm.NFC.String(content)
+	}
+	return strings.TrimSpace(content)
+}
+
+// Equal reports whether local and server content are the same under rules
+func Equal(local, server string, rules Rules) bool {
+	return Normalize(local, rules) == Normalize(server, rules)
+}
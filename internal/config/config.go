@@ -1,319 +1,247 @@
 package config
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/joho/godotenv"
 	"gopkg.in/ini.v1"
 )
 
 type Config struct {
-	Token string
-	URL   string
-	KBKey string
+	Token   string
+	URL     string
+	KBKey   string
+	Project Project
+
+	// Profile is the config.ini section connected with, empty for [config]
+	Profile string
+	// chosen is set when the profile was picked with --profile or
+	// YTKB_PROFILE, which then also applies to every knowledge base
+	chosen bool
+	// local is set for configurations read by LoadLocal
+	local bool
 }
 
-func Load() (*Config, error) {
+// Environment variables that override the configuration files
+const (
+	ProfileEnv = "YTKB_PROFILE"
+	URLEnv     = "YTKB_URL"
+	TokenEnv   = "YTKB_TOKEN"
+	KBEnv      = "YTKB_KB"
+)
+
+// Options override the configuration files. Empty fields fall back to
+// their environment variable, then to the files.
+type Options struct {
+	Profile string
+	URL     string
+	Token   string
+	KB      string
+}
+
+func (o *Options) fromEnv() {
+	for _, opt := range []struct {
+		value *string
+		env   string
+	}{
+		{&o.Profile, ProfileEnv},
+		{&o.URL, URLEnv},
+		{&o.Token, TokenEnv},
+		{&o.KB, KBEnv},
+	} {
+		if *opt.value == "" {
+			*opt.value = os.Getenv(opt.env)
+		}
+	}
+}
+
+// Load reads the configuration. The connection comes from the URL and
+// token options, or from the config.ini section of the chosen profile, the
+// workspace's default profile or [config], in that order.
+func Load(opts Options) (*Config, error) {
 	cfg := &Config{}
+	opts.fromEnv()
 
-	// Load global config
-	configPath, err := getConfigPath()
-	if err != nil {
+	// Load optional project settings
+	if err := loadProject(cfg); err != nil {
 		return nil, err
 	}
 
-	if err := loadConfigFile(configPath, cfg); err != nil {
-		if os.IsNotExist(err) {
-			if err := createConfigFileInteractive(configPath, cfg); err != nil {
-				return nil, err
-			}
-		} else {
+	// An explicit connection also applies to every knowledge base
+	cfg.chosen = opts.Profile != "" || opts.URL != "" || opts.Token != ""
+
+	if opts.URL == "" || opts.Token == "" {
+		profile := opts.Profile
+		if profile == "" {
+			profile = cfg.Project.Profile
+		}
+		// A token given directly means token_command never has to run
+		if err := loadGlobal(profile, cfg, opts.Token == ""); err != nil {
 			return nil, err
 		}
 	}
+	if opts.URL != "" {
+		cfg.URL = opts.URL
+	}
+	if opts.Token != "" {
+		cfg.Token = opts.Token
+	}
+
+	// In multi-KB workspaces the key only chooses one of the knowledge
+	// bases in ytkb.yaml
+	cfg.KBKey = opts.KB
+	if cfg.KBKey != "" || len(cfg.Project.KnowledgeBases) > 0 {
+		return cfg, nil
+	}
 
 	// Load KB_KEY from .env
 	if err := loadKBKey(cfg); err != nil {
 		if os.IsNotExist(err) {
-			if err := selectKnowledgeBaseInteractive(cfg); err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
+			return nil, fmt.Errorf("no knowledge base: run `ytkb init`, set %s or pass --kb", KBEnv)
 		}
+		return nil, err
 	}
 
 	return cfg, nil
 }
 
-func getConfigPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
-	}
-	return filepath.Join(homeDir, ".config", "youtrack_writer", "config.ini"), nil
-}
+// LoadLocal reads what offline commands need: the workspace settings, and
+// the server URL if one is configured, to recognise links to it. It never
+// prompts and works without any configuration files.
+func LoadLocal(opts Options) (*Config, error) {
+	cfg := &Config{local: true}
+	opts.fromEnv()
 
-func loadConfigFile(path string, cfg *Config) error {
-	iniFile, err := ini.Load(path)
-	if err != nil {
-		return err
+	if err := loadProject(cfg); err != nil {
+		return nil, err
 	}
 
-	section := iniFile.Section("config")
-	cfg.Token = section.Key("token").String()
-	cfg.URL = section.Key("url").String()
-
-	if cfg.Token == "" || cfg.URL == "" {
-		return fmt.Errorf("invalid config: missing token or url")
+	cfg.chosen = opts.Profile != "" || opts.URL != ""
+	cfg.URL = opts.URL
+	if cfg.URL == "" {
+		profile := opts.Profile
+		if profile == "" {
+			profile = cfg.Project.Profile
+		}
+		cfg.URL = localURL(profile)
 	}
-
-	return nil
+	cfg.KBKey = opts.KB
+	return cfg, nil
 }
 
-func createConfigFileInteractive(path string, cfg *Config) error {
-	fmt.Println("Configuration file not found. Let's set it up!")
-
-	reader := bufio.NewReader(os.Stdin)
-
-	fmt.Print("Enter YouTrack server URL: ")
-	url, err := reader.ReadString('\n')
+// localURL returns the server URL of a profile, or nothing if it can't be
+// read
+func localURL(profile string) string {
+	configPath, err := ConfigPath()
 	if err != nil {
-		return fmt.Errorf("failed to read URL: %w", err)
+		return ""
 	}
-	cfg.URL = strings.TrimSpace(url)
-
-	fmt.Print("Enter API token: ")
-	token, err := reader.ReadString('\n')
+	global, err := ini.Load(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to read token: %w", err)
+		return ""
 	}
-	cfg.Token = strings.TrimSpace(token)
-
-	// Create directory
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
-	}
-
-	// Create file
-	iniFile := ini.Empty()
-	section, _ := iniFile.NewSection("config")
-	section.NewKey("token", cfg.Token)
-	section.NewKey("url", cfg.URL)
-
-	if err := iniFile.SaveTo(path); err != nil {
-		return fmt.Errorf("failed to save config file: %w", err)
+	section, err := global.GetSection(profileSection(profile))
+	if err != nil {
+		return ""
 	}
-
-	fmt.Printf("Configuration saved to %s\n", path)
-	return nil
+	return section.Key("url").String()
 }
 
-func loadKBKey(cfg *Config) error {
-	if err := godotenv.Load(); err != nil {
+// loadGlobal reads the connection of a profile from config.ini, without
+// the token unless needToken is set
+func loadGlobal(profile string, cfg *Config, needToken bool) error {
+	configPath, err := ConfigPath()
+	if err != nil {
 		return err
 	}
 
-	kbKey := os.Getenv("KB_KEY")
-	if kbKey == "" {
-		return fmt.Errorf("KB_KEY not found in .env")
+	err = loadConfigFile(configPath, profileSection(profile), cfg, needToken)
+	switch {
+	case err == nil:
+		cfg.Profile = profile
+		return nil
+	case !os.IsNotExist(err):
+		return err
+	case profile != "":
+		return fmt.Errorf("profile %s not found: %s does not exist", profile, configPath)
 	}
-
-	cfg.KBKey = kbKey
-	return nil
+	return fmt.Errorf("%s does not exist: run `ytkb init`, or set %s and %s", configPath, URLEnv, TokenEnv)
 }
 
-func selectKnowledgeBaseInteractive(cfg *Config) error {
-	fmt.Println(".env file not found. Let's select a knowledge base.")
-
-	// Try to list knowledge bases
-	apiClient := NewAPIClientForKBSelection(cfg)
-	bases, err := apiClient.ListKnowledgeBases()
-	if err != nil {
-		// Fallback to manual input
-		fmt.Printf("Could not list knowledge bases: %v\n", err)
-		fmt.Println("Please enter KB_KEY manually.")
-		return promptForKBKey(cfg)
-	}
-
-	if len(bases) == 0 {
-		fmt.Println("No knowledge bases found.")
-		return promptForKBKey(cfg)
-	}
-
-	fmt.Println("\nAvailable knowledge bases:")
-	for i, kb := range bases {
-		fmt.Printf("  %d. %s (key: %s)\n", i+1, kb.Name, kb.Key)
-	}
-
-	fmt.Print("\nEnter number or KB_KEY: ")
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+// ConfigPath is where the global configuration lives
+func ConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("failed to read input: %w", err)
-	}
-	input = strings.TrimSpace(input)
-
-	// Try to parse as number
-	var kbKey string
-	if num, err := parseInt(input); err == nil && num > 0 && num <= len(bases) {
-		kbKey = bases[num-1].Key
-	} else {
-		kbKey = input
-	}
-
-	cfg.KBKey = kbKey
-
-	// Save to .env
-	envContent := fmt.Sprintf("KB_KEY=%s\n", kbKey)
-	if err := os.WriteFile(".env", []byte(envContent), 0644); err != nil {
-		return fmt.Errorf("failed to save .env file: %w", err)
+		return "", fmt.Errorf("failed to get home directory: %w", err)
 	}
-
-	fmt.Println("KB_KEY saved to .env")
-	return nil
+	return filepath.Join(homeDir, ".config", "youtrack_writer", "config.ini"), nil
 }
 
-func promptForKBKey(cfg *Config) error {
-	fmt.Print("Enter Knowledge Base KEY: ")
-	reader := bufio.NewReader(os.Stdin)
-	kbKey, err := reader.ReadString('\n')
-	if err != nil {
-		return fmt.Errorf("failed to read KB_KEY: %w", err)
-	}
-	kbKey = strings.TrimSpace(kbKey)
+// defaultSection holds the connection used unless a profile is chosen
+const defaultSection = "config"
 
-	cfg.KBKey = kbKey
-
-	// Save to .env
-	envContent := fmt.Sprintf("KB_KEY=%s\n", kbKey)
-	if err := os.WriteFile(".env", []byte(envContent), 0644); err != nil {
-		return fmt.Errorf("failed to save .env file: %w", err)
+// profileSection is the config.ini section of a profile. Profiles are
+// sections named after them, such as [staging].
+func profileSection(profile string) string {
+	if profile == "" {
+		return defaultSection
 	}
-
-	fmt.Println("KB_KEY saved to .env")
-	return nil
-}
-
-func parseInt(s string) (int, error) {
-	var result int
-	_, err := fmt.Sscanf(s, "%d", &result)
-	return result, err
-}
-
-// Temporary API client for KB selection (to avoid circular dependency)
-type APIClientForKBSelection struct {
-	cfg *Config
-}
-
-type KnowledgeBase struct {
-	Key  string
-	Name string
-}
-
-func NewAPIClientForKBSelection(cfg *Config) *APIClientForKBSelection {
-	return &APIClientForKBSelection{cfg: cfg}
-}
-
-func (c *APIClientForKBSelection) ListKnowledgeBases() ([]KnowledgeBase, error) {
-	// Use the actual API client
-	client := &apiClientWrapper{cfg: c.cfg}
-	return client.ListKnowledgeBases()
-}
-
-// Wrapper to avoid circular dependency
-type apiClientWrapper struct {
-	cfg *Config
+	return profile
 }
 
-func (c *apiClientWrapper) ListKnowledgeBases() ([]KnowledgeBase, error) {
-	// Try /api/knowledgeBases first (for newer YouTrack versions)
-	baseURL := strings.TrimSuffix(c.cfg.URL, "/")
-	url := fmt.Sprintf("%s/api/knowledgeBases", baseURL)
-
-	req, err := http.NewRequest("GET", url, nil)
+func loadConfigFile(path, name string, cfg *Config, needToken bool) error {
+	iniFile, err := ini.Load(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
-	req.Header.Set("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	section, err := iniFile.GetSection(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request to %s: %w", url, err)
-	}
-	defer resp.Body.Close()
-
-	// If knowledgeBases endpoint works, use it
-	if resp.StatusCode == http.StatusOK {
-		var bases []KnowledgeBase
-		if err := json.NewDecoder(resp.Body).Decode(&bases); err != nil {
-			return nil, fmt.Errorf("failed to decode response: %w", err)
+		if name == defaultSection {
+			return fmt.Errorf("invalid config: no [%s] section in %s: run `ytkb init`", name, path)
 		}
-		return bases, nil
+		return fmt.Errorf("profile %s not found: no [%s] section in %s", name, name, path)
 	}
-
-	// Fallback: Use /api/articles to get unique projects (knowledge bases)
-	// This works by getting articles and extracting unique projects
-	url = fmt.Sprintf("%s/api/articles?fields=project(id,name)&$top=1000", baseURL)
-	req, err = http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.cfg.Token))
-	req.Header.Set("Accept", "application/json")
-
-	resp, err = client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request to %s: %w", url, err)
+	warnIfOpen(path, iniFile)
+	cfg.URL = section.Key("url").String()
+	if !needToken {
+		if cfg.URL == "" {
+			return fmt.Errorf("invalid config: missing url in [%s] of %s: run `ytkb init`", name, path)
+		}
+		return nil
 	}
-	defer resp.Body.Close()
+	cfg.Token = section.Key("token").String()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	if command := section.Key("token_command").String(); command != "" {
+		if cfg.Token != "" {
+			return fmt.Errorf("invalid config: [%s] of %s sets both token and token_command", name, path)
+		}
+		token, err := RunTokenCommand(command)
+		if err != nil {
+			return err
+		}
+		cfg.Token = token
 	}
 
-	// Parse articles response to extract unique projects
-	type ArticleResponse struct {
-		Project struct {
-			ID   string `json:"id"`
-			Name string `json:"name"`
-		} `json:"project"`
+	if cfg.Token == "" || cfg.URL == "" {
+		return fmt.Errorf("invalid config: missing token or url in [%s] of %s: run `ytkb init`", name, path)
 	}
 
-	var articles []ArticleResponse
-	if err := json.NewDecoder(resp.Body).Decode(&articles); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
+	return nil
+}
 
-	// Extract unique projects
-	projectMap := make(map[string]string)
-	for _, article := range articles {
-		if article.Project.ID != "" && article.Project.Name != "" {
-			projectMap[article.Project.ID] = article.Project.Name
-		}
+func loadKBKey(cfg *Config) error {
+	if err := godotenv.Load(); err != nil {
+		return err
 	}
 
-	// Convert to KnowledgeBase slice
-	bases := make([]KnowledgeBase, 0, len(projectMap))
-	for id, name := range projectMap {
-		bases = append(bases, KnowledgeBase{
-			Key:  id,
-			Name: name,
-		})
+	kbKey := os.Getenv("KB_KEY")
+	if kbKey == "" {
+		return fmt.Errorf("KB_KEY not found in .env")
 	}
 
-	return bases, nil
+	cfg.KBKey = kbKey
+	return nil
 }
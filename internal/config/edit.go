@@ -0,0 +1,424 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are named by key. url, token and token_command live in the profile's section of
+// config.ini, kb in .env, and everything else in ytkb.yaml, with dotted keys
+// for nested settings such as compare.format.
+const (
+	KeyURL   = "url"
+	KeyToken = "token"
+	KeyKB    = "kb"
+)
+
+// EnvFile holds the knowledge base key of a single-KB workspace
+const EnvFile = ".env"
+
+// Setting is one configured value, as shown by `ytkb config list`
+type Setting struct {
+	Key   string
+	Value string
+}
+
+// IsGlobal reports whether a setting lives in config.ini
+func IsGlobal(key string) bool {
+	return key == KeyURL || key == KeyToken || key == KeyTokenCommand
+}
+
+// IsSecret reports whether a setting must be masked in output
+func IsSecret(key string) bool {
+	return key == KeyToken
+}
+
+// Mask hides a secret but for its last characters, enough to tell tokens
+// apart
+func Mask(value string) string {
+	if len(value) <= 8 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
+
+// GlobalSettings returns the settings of a profile, or of [config]
+func GlobalSettings(profile string) ([]Setting, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	iniFile, err := ini.Load(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	section, err := iniFile.GetSection(profileSection(profile))
+	if err != nil {
+		return nil, nil
+	}
+
+	var settings []Setting
+	for _, key := range section.Keys() {
+		settings = append(settings, Setting{Key: key.Name(), Value: key.String()})
+	}
+	return settings, nil
+}
+
+// SetGlobal changes settings of a profile, or of [config]. Empty values
+// remove their setting.
+func SetGlobal(profile string, values map[string]string) error {
+	if url, ok := values[KeyURL]; ok && url != "" {
+		if err := ValidateURL(url); err != nil {
+			return err
+		}
+	}
+
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	iniFile, err := ini.Load(path)
+	if os.IsNotExist(err) {
+		if removesOnly(values) {
+			return nil
+		}
+		iniFile = ini.Empty()
+	} else if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	section, err := iniFile.GetSection(profileSection(profile))
+	if err != nil {
+		if removesOnly(values) {
+			return nil
+		}
+		section, _ = iniFile.NewSection(profileSection(profile))
+	}
+	for key, value := range values {
+		if value == "" {
+			section.DeleteKey(key)
+		} else {
+			section.Key(key).SetValue(value)
+		}
+	}
+
+	return saveGlobal(iniFile, path)
+}
+
+func removesOnly(values map[string]string) bool {
+	for _, value := range values {
+		if value != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateURL checks that a server URL can be connected to
+func ValidateURL(url string) error {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return fmt.Errorf("invalid url %s: must start with https:// or http://", url)
+	}
+	return nil
+}
+
+// ReadKBKey returns the knowledge base key in .env, if any
+func ReadKBKey() (string, error) {
+	values, err := godotenv.Read(EnvFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read %s: %w", EnvFile, err)
+	}
+	return values["KB_KEY"], nil
+}
+
+// SetKBKey writes the knowledge base key to .env, keeping any other
+// variables in it. An empty key removes it.
+func SetKBKey(key string) error {
+	values, err := godotenv.Read(EnvFile)
+	if os.IsNotExist(err) {
+		values = make(map[string]string)
+	} else if err != nil {
+		return fmt.Errorf("failed to read %s: %w", EnvFile, err)
+	}
+
+	if key == "" {
+		delete(values, "KB_KEY")
+	} else {
+		values["KB_KEY"] = key
+	}
+
+	if len(values) == 0 {
+		if err := os.Remove(EnvFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", EnvFile, err)
+		}
+		return nil
+	}
+	if err := godotenv.Write(values, EnvFile); err != nil {
+		return fmt.Errorf("failed to save %s: %w", EnvFile, err)
+	}
+	return nil
+}
+
+// ProjectSettings lists the settings in ytkb.yaml. Lists are joined with
+// commas, and entries of lists of groups are numbered, as in
+// knowledge_bases.0.key.
+func ProjectSettings() ([]Setting, error) {
+	doc, err := readProjectNode()
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	var settings []Setting
+	flatten("", doc.Content[0], &settings)
+	return settings, nil
+}
+
+func flatten(prefix string, node *yaml.Node, settings *[]Setting) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*settings = append(*settings, Setting{Key: prefix, Value: node.Value})
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			flatten(join(prefix, node.Content[i].Value), node.Content[i+1], settings)
+		}
+	case yaml.SequenceNode:
+		var values []string
+		for i, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				flatten(join(prefix, strconv.Itoa(i)), item, settings)
+				continue
+			}
+			values = append(values, item.Value)
+		}
+		if len(values) > 0 || len(node.Content) == 0 {
+			*settings = append(*settings, Setting{Key: prefix, Value: strings.Join(values, ",")})
+		}
+	}
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// SetProject changes a setting in ytkb.yaml, keeping the rest of the file
+// and its comments. List settings take several values.
+func SetProject(key string, values []string) error {
+	value, err := settingNode(key, values)
+	if err != nil {
+		return err
+	}
+
+	doc, err := readProjectNode()
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	node := doc.Content[0]
+	segments := strings.Split(key, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		child := lookup(node, segment)
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: segment}, child)
+		} else if child.Kind != yaml.MappingNode {
+			// Groups are mappings, so anything else here was empty or invalid
+			*child = yaml.Node{Kind: yaml.MappingNode}
+		}
+		node = child
+	}
+
+	last := segments[len(segments)-1]
+	if existing := lookup(node, last); existing != nil {
+		value.HeadComment, value.LineComment, value.FootComment = existing.HeadComment, existing.LineComment, existing.FootComment
+		*existing = *value
+	} else {
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: last}, value)
+	}
+	return writeProjectNode(doc)
+}
+
+// UnsetProject removes a setting from ytkb.yaml, and the file if nothing
+// is left in it
+func UnsetProject(key string) error {
+	if _, err := settingType(key); err != nil {
+		return err
+	}
+
+	doc, err := readProjectNode()
+	if err != nil || doc == nil {
+		return err
+	}
+	if !remove(doc.Content[0], strings.Split(key, ".")) {
+		return nil
+	}
+
+	if len(doc.Content[0].Content) == 0 {
+		if err := os.Remove(ProjectFile); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", ProjectFile, err)
+		}
+		return nil
+	}
+	return writeProjectNode(doc)
+}
+
+// remove deletes a key from a mapping, and the groups it empties
+func remove(node *yaml.Node, segments []string) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != segments[0] {
+			continue
+		}
+		if len(segments) > 1 {
+			child := node.Content[i+1]
+			if child.Kind != yaml.MappingNode || !remove(child, segments[1:]) {
+				return false
+			}
+			if len(child.Content) > 0 {
+				return true
+			}
+		}
+		node.Content = append(node.Content[:i], node.Content[i+2:]...)
+		return true
+	}
+	return false
+}
+
+// lookup returns the value of a key in a mapping
+func lookup(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// CheckProjectKey returns an error for keys that are not ytkb.yaml settings
+func CheckProjectKey(key string) error {
+	_, err := settingType(key)
+	return err
+}
+
+// settingNode builds the YAML value of a setting, checked against its type
+func settingNode(key string, values []string) (*yaml.Node, error) {
+	t, err := settingType(key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+		list := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, value := range values {
+			list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+		}
+		return list, nil
+	case t.Kind() == reflect.Struct:
+		return nil, fmt.Errorf("%s is a group of settings: set one of them, such as %s.%s", key, key, yamlName(t.Field(0)))
+	case t.Kind() != reflect.Bool && t.Kind() != reflect.String:
+		return nil, fmt.Errorf("%s cannot be set with ytkb config: edit %s instead", key, ProjectFile)
+	case len(values) != 1:
+		return nil, fmt.Errorf("%s takes a single value", key)
+	}
+
+	if t.Kind() == reflect.Bool {
+		value, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", key)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(value)}, nil
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: values[0]}, nil
+}
+
+// settingType finds the type of a ytkb.yaml setting by its dotted key
+func settingType(key string) (reflect.Type, error) {
+	t := reflect.TypeOf(Project{})
+	for _, segment := range strings.Split(key, ".") {
+		if t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+		field, ok := fieldByName(t, segment)
+		if !ok {
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+		t = field.Type
+	}
+	return t, nil
+}
+
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if yamlName(t.Field(i)) == name {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func yamlName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("yaml"), ",")[0]
+}
+
+func readProjectNode() (*yaml.Node, error) {
+	data, err := os.ReadFile(ProjectFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", ProjectFile, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ProjectFile, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("invalid %s: settings must be a mapping", ProjectFile)
+	}
+	return &doc, nil
+}
+
+// writeProjectNode saves ytkb.yaml if the result is still a valid project
+func writeProjectNode(doc *yaml.Node) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", ProjectFile, err)
+	}
+	data := buf.Bytes()
+	project, err := parseProject(ProjectFile, data)
+	if err != nil {
+		return err
+	}
+	if err := validateKBs(project.KnowledgeBases); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(ProjectFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to save %s: %w", ProjectFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ytkb/internal/archive"
+	"ytkb/internal/compare"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFile is the optional per-workspace configuration file, read from
+// the directory ytkb is run in.
+const ProjectFile = "ytkb.yaml"
+
+// What download does with local files whose article was deleted on the server
+const (
+	OrphanedKeep   = "keep"
+	OrphanedMove   = "move"
+	OrphanedDelete = "delete"
+)
+
+// KBDir maps a knowledge base to a subdirectory of the workspace
+type KBDir struct {
+	Key string `yaml:"key"`
+	Dir string `yaml:"dir"`
+	// Profile names the config.ini section to connect with, if the
+	// knowledge base lives on another server than the default one
+	Profile string `yaml:"profile,omitempty"`
+}
+
+type Project struct {
+	// KnowledgeBases mirrors several knowledge bases side by side, each in
+	// its own directory with its own sync state. Empty means the workspace
+	// mirrors the one knowledge base named in .env.
+	KnowledgeBases []KBDir `yaml:"knowledge_bases,omitempty"`
+
+	// LocalKeys lists frontmatter keys that only live in local files. They
+	// are preserved on download and never sent to YouTrack.
+	LocalKeys []string `yaml:"local_keys,omitempty"`
+
+	// Profile is the config.ini section this workspace connects with by
+	// default, instead of [config]
+	Profile string `yaml:"profile,omitempty"`
+
+	// Roots limits the workspace to these articles and their descendants,
+	// given by id or title path. Empty means the whole knowledge base.
+	Roots []string `yaml:"roots,omitempty"`
+
+	// Compare relaxes how local and server content are compared
+	Compare compare.Rules `yaml:"compare,omitempty"`
+
+	// Archive configures push --archive and restore
+	Archive archive.Settings `yaml:"archive,omitempty"`
+
+	// Orphaned is OrphanedKeep, OrphanedMove or OrphanedDelete
+	Orphaned string `yaml:"orphaned,omitempty"`
+}
+
+// reservedKeys cannot be local-only because ytkb needs them to sync.
+var reservedKeys = []string{"id", "title"}
+
+func loadProject(cfg *Config) error {
+	project, err := readProject(ProjectFile)
+	if err != nil || project == nil {
+		return err
+	}
+
+	if err := validateKBs(project.KnowledgeBases); err != nil {
+		return err
+	}
+
+	cfg.Project = *project
+	return nil
+}
+
+// readProject reads and validates a project file. It returns nil if the
+// file does not exist.
+func readProject(path string) (*Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return parseProject(path, data)
+}
+
+func parseProject(path string, data []byte) (*Project, error) {
+	var project Project
+	if err := yaml.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for _, key := range project.LocalKeys {
+		for _, reserved := range reservedKeys {
+			if key == reserved {
+				return nil, fmt.Errorf("invalid %s: %q cannot be a local key", path, key)
+			}
+		}
+	}
+
+	switch project.Orphaned {
+	case "":
+		project.Orphaned = OrphanedKeep
+	case OrphanedKeep, OrphanedMove, OrphanedDelete:
+	default:
+		return nil, fmt.Errorf("invalid %s: orphaned must be %s, %s or %s", path, OrphanedKeep, OrphanedMove, OrphanedDelete)
+	}
+
+	return &project, nil
+}
+
+func validateKBs(kbs []KBDir) error {
+	dirs := make(map[string]string)
+	for _, kb := range kbs {
+		if kb.Key == "" || kb.Dir == "" {
+			return fmt.Errorf("invalid %s: every knowledge base needs a key and a dir", ProjectFile)
+		}
+		dir := filepath.Clean(kb.Dir)
+		if filepath.IsAbs(dir) || dir == "." || strings.HasPrefix(dir, "..") {
+			return fmt.Errorf("invalid %s: dir of %s must be a subdirectory of the workspace", ProjectFile, kb.Key)
+		}
+		if other, ok := dirs[dir]; ok {
+			return fmt.Errorf("invalid %s: %s and %s share the directory %s", ProjectFile, other, kb.Key, kb.Dir)
+		}
+		dirs[dir] = kb.Key
+	}
+
+	// A knowledge base would take the files of one nested in it as its own
+	for dir, key := range dirs {
+		for other, otherKey := range dirs {
+			if strings.HasPrefix(other, dir+string(filepath.Separator)) {
+				return fmt.Errorf("invalid %s: the directory of %s is inside that of %s", ProjectFile, otherKey, key)
+			}
+		}
+	}
+	return nil
+}
+
+// ForKB returns the configuration for one knowledge base of a multi-KB
+// workspace. A ytkb.yaml in its directory replaces the workspace settings.
+func (c *Config) ForKB(kb KBDir) (*Config, error) {
+	kbCfg := *c
+	kbCfg.KBKey = kb.Key
+
+	project, err := readProject(filepath.Join(kb.Dir, ProjectFile))
+	if err != nil {
+		return nil, err
+	}
+	if project != nil {
+		if len(project.KnowledgeBases) > 0 {
+			return nil, fmt.Errorf("invalid %s: knowledge bases cannot be nested", filepath.Join(kb.Dir, ProjectFile))
+		}
+		kbCfg.Project = *project
+	}
+	kbCfg.Project.KnowledgeBases = nil
+
+	// A profile chosen on the command line wins over the workspace's
+	profile := kb.Profile
+	if profile == "" && project != nil {
+		profile = project.Profile
+	}
+	if profile != "" && !c.chosen && profile != c.Profile {
+		if c.local {
+			// Offline commands only need the URL, if there is one
+			kbCfg.URL = localURL(profile)
+		} else {
+			configPath, err := ConfigPath()
+			if err != nil {
+				return nil, err
+			}
+			if err := loadConfigFile(configPath, profile, &kbCfg, true); err != nil {
+				return nil, fmt.Errorf("failed to load profile for %s: %w", kb.Key, err)
+			}
+		}
+		kbCfg.Profile = profile
+	}
+	return &kbCfg, nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// KeyTokenCommand is a shell command whose output is the token, so that
+// tokens can live in a password manager instead of config.ini
+const KeyTokenCommand = "token_command"
+
+// RunTokenCommand runs a token_command and returns the first line of its
+// output, as password managers such as pass print the password first
+func RunTokenCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	// Let the command ask for a passphrase
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("token_command %q failed: %w", command, err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	token := strings.TrimSpace(line)
+	if token == "" {
+		return "", fmt.Errorf("token_command %q printed no token", command)
+	}
+	return token, nil
+}
+
+// warned keeps warnIfOpen from repeating itself when config.ini is read
+// once per knowledge base
+var warned = make(map[string]bool)
+
+// warnIfOpen warns when a config file holding tokens can be read by other
+// users
+func warnIfOpen(path string, iniFile *ini.File) {
+	if runtime.GOOS == "windows" || warned[path] {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm()&0077 == 0 {
+		return
+	}
+	for _, section := range iniFile.Sections() {
+		if section.HasKey("token") {
+			warned[path] = true
+			fmt.Fprintf(os.Stderr, "Warning: %s holds API tokens but other users can read it. Run: chmod 600 %s\n", path, path)
+			return
+		}
+	}
+}
+
+// saveGlobal writes config.ini readable by its owner only, tightening
+// existing files
+func saveGlobal(iniFile *ini.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to save config file: %w", err)
+	}
+	if err := writeINI(file, iniFile); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to save config file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to save config file: %w", err)
+	}
+	return nil
+}
+
+// writeINI writes the config to an open file, readable by its owner only
+func writeINI(file *os.File, iniFile *ini.File) error {
+	if err := file.Chmod(0600); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if _, err := iniFile.WriteTo(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
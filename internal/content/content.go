@@ -0,0 +1,99 @@
+package content
+
+import (
+	"ytkb/internal/api"
+	"ytkb/internal/assets"
+	"ytkb/internal/links"
+	"ytkb/internal/markdown"
+	"ytkb/internal/state"
+)
+
+// Converter turns article bodies between their local and server forms
+type Converter struct {
+	state *state.State
+	links *links.Index
+}
+
+// NewConverter creates a converter for a server at baseURL. articles are
+// the articles with a local file, for link rewriting.
+func NewConverter(baseURL string, st *state.State, articles []links.Article) *Converter {
+	return &Converter{state: st, links: links.NewIndex(baseURL, articles)}
+}
+
+// ServerContent converts a local article body to the form YouTrack stores.
+// It also returns the local files the body references that have to be
+// uploaded as new attachments.
+func (c *Converter) ServerContent(filePath string, md *markdown.MarkdownFile, article *api.Article) (string, []assets.Upload) {
+	var originals map[string]string
+	if entry, ok := c.state.Articles[article.ID]; ok {
+		originals = entry.Links
+	}
+
+	content := c.links.ToServer(md.Content, filePath, originals)
+	return assets.ToServer(content, filePath, ExistingAttachments(article, c.state))
+}
+
+// LocalContent converts an article body from YouTrack to its local form and
+// records how its links were rewritten
+func (c *Converter) LocalContent(filePath string, article *api.Article) string {
+	content := assets.ToLocal(article.Content, filePath, AttachmentNames(article))
+	content, originals := c.links.ToLocal(content, filePath)
+
+	entry := c.state.Article(article.ID)
+	entry.Links = nil
+	if len(originals) > 0 {
+		entry.Links = originals
+	}
+	return content
+}
+
+// AttachmentNames lists the names of an article's attachments
+func AttachmentNames(article *api.Article) []string {
+	if article == nil {
+		return nil
+	}
+	names := make([]string, 0, len(article.Attachments))
+	for _, attachment := range article.Attachments {
+		names = append(names, attachment.Name)
+	}
+	return names
+}
+
+// ExistingAttachments pairs an article's attachments with the hashes
+// recorded when they were last synced
+func ExistingAttachments(article *api.Article, st *state.State) []assets.Existing {
+	if article == nil {
+		return nil
+	}
+
+	var recorded map[string]state.Attachment
+	if entry, ok := st.Articles[article.ID]; ok {
+		recorded = entry.Attachments
+	}
+
+	existing := make([]assets.Existing, 0, len(article.Attachments))
+	for _, attachment := range article.Attachments {
+		existing = append(existing, assets.Existing{
+			Name: attachment.Name,
+			Hash: recorded[attachment.Name].Hash,
+		})
+	}
+	return existing
+}
+
+// LinkArticles lists the articles that have a local file, for link
+// rewriting. localPaths maps article ids to their files. Readable ids of
+// articles missing from serverByID come from the sync state.
+func LinkArticles(localPaths map[string]string, serverByID map[string]*api.Article, st *state.State) []links.Article {
+	articles := make([]links.Article, 0, len(localPaths))
+	for id, path := range localPaths {
+		article := links.Article{ID: id, Path: path}
+		if serverArticle, ok := serverByID[id]; ok {
+			article.IDReadable = serverArticle.IDReadable
+		} else if entry, ok := st.Articles[id]; ok {
+			article.IDReadable = entry.IDReadable
+		}
+		articles = append(articles, article)
+	}
+	return articles
+}
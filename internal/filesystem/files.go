@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"ytkb/internal/assets"
 )
 
 func SanitizeFilename(name string) string {
@@ -28,6 +30,14 @@ func FindMarkdownFiles(basePath string) ([]string, error) {
 			return err
 		}
 
+		// Skip hidden directories such as .git and .ytkb, and attachments
+		if info.IsDir() && path != basePath {
+			name := info.Name()
+			if strings.HasPrefix(name, ".") || strings.HasSuffix(name, assets.Suffix) {
+				return filepath.SkipDir
+			}
+		}
+
 		if !info.IsDir() && strings.HasSuffix(path, ".md") {
 			relPath, err := filepath.Rel(basePath, path)
 			if err != nil {
@@ -93,3 +103,12 @@ func WriteMarkdownFile(filePath string, content string) error {
 	return os.WriteFile(filePath, []byte(content), 0644)
 }
 
+func WriteFile(filePath string, data []byte) error {
+	// Create directory if needed
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	return os.WriteFile(filePath, data, 0644)
+}
@@ -0,0 +1,198 @@
+package links
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"ytkb/internal/markdown"
+)
+
+var (
+	// readableID matches article ids such as KB-A-42
+	readableID = regexp.MustCompile(`^[A-Za-z0-9_]+-A-\d+$`)
+	// internalID matches database ids such as 173-5
+	internalID = regexp.MustCompile(`^\d+-\d+$`)
+)
+
+// Article is an article with a local file
+type Article struct {
+	ID         string
+	IDReadable string
+	Path       string
+}
+
+// Index maps articles to local files and back
+type Index struct {
+	baseURL string
+	byRef   map[string]Article
+	byPath  map[string]Article
+}
+
+// NewIndex indexes articles for a server at baseURL
+func NewIndex(baseURL string, articles []Article) *Index {
+	ix := &Index{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		byRef:   make(map[string]Article),
+		byPath:  make(map[string]Article),
+	}
+	for _, article := range articles {
+		if article.Path == "" {
+			continue
+		}
+		ix.byRef[article.ID] = article
+		if article.IDReadable != "" {
+			ix.byRef[article.IDReadable] = article
+		}
+		ix.byPath[filepath.Clean(article.Path)] = article
+	}
+	return ix
+}
+
+// Lookup finds an indexed article by id or idReadable
+func (ix *Index) Lookup(ref string) (Article, bool) {
+	article, ok := ix.byRef[ref]
+	return article, ok
+}
+
+// ArticleRef extracts the article id from a server link target: an article
+// URL on this server, a root-relative /articles/ path or a bare id. The
+// remainder after the id, such as a title slug or #anchor, is returned too.
+func (ix *Index) ArticleRef(target string) (ref, fragment string, ok bool) {
+	rest := ""
+	switch {
+	case ix.baseURL != "" && strings.HasPrefix(target, ix.baseURL+"/articles/"):
+		rest = strings.TrimPrefix(target, ix.baseURL+"/articles/")
+	case strings.HasPrefix(target, "/articles/"):
+		rest = strings.TrimPrefix(target, "/articles/")
+	case readableID.MatchString(target) || internalID.MatchString(target):
+		return target, "", true
+	default:
+		return "", "", false
+	}
+
+	ref = rest
+	if i := strings.IndexAny(rest, "/?#"); i != -1 {
+		ref = rest[:i]
+	}
+	if i := strings.Index(rest, "#"); i != -1 {
+		fragment = rest[i:]
+	}
+	return ref, fragment, ref != ""
+}
+
+// ToLocal rewrites links to indexed articles into paths relative to the
+// article file at fromPath. It returns the original target of every link it
+// rewrote, keyed by the new one, so ToServer can restore them exactly.
+func (ix *Index) ToLocal(content, fromPath string) (string, map[string]string) {
+	originals := make(map[string]string)
+
+	rewritten := markdown.RewriteLinks(content, func(link markdown.Link) string {
+		if _, _, ok := ix.Resolve(link.Target, link.Angle, fromPath); ok {
+			// Already a relative link on the server; keep it that way
+			originals[link.Target] = link.Target
+			return link.Target
+		}
+
+		ref, fragment, ok := ix.ArticleRef(link.Target)
+		if !ok {
+			return link.Target
+		}
+		article, ok := ix.byRef[ref]
+		if !ok {
+			return link.Target
+		}
+
+		local := relativeTarget(fromPath, article.Path, link.Angle) + fragment
+		if previous, seen := originals[local]; seen && previous != link.Target {
+			// Two different server forms map to the same local link; keep
+			// the second one as it is so both survive the round trip
+			return link.Target
+		}
+		originals[local] = link.Target
+		return local
+	})
+
+	return rewritten, originals
+}
+
+// ToServer turns relative links to local article files back into server
+// links. Links rewritten by ToLocal get their original target back, others
+// become absolute article URLs.
+func (ix *Index) ToServer(content, fromPath string, originals map[string]string) string {
+	return markdown.RewriteLinks(content, func(link markdown.Link) string {
+		article, fragment, ok := ix.Resolve(link.Target, link.Angle, fromPath)
+		if !ok {
+			return link.Target
+		}
+
+		if original, ok := originals[link.Target]; ok {
+			if original == link.Target {
+				return original
+			}
+			// Only reuse the original if it still names the same article
+			if ref, _, ok := ix.ArticleRef(original); ok {
+				if target, ok := ix.byRef[ref]; ok && target.ID == article.ID {
+					return original
+				}
+			}
+		}
+
+		id := article.IDReadable
+		if id == "" {
+			id = article.ID
+		}
+		return ix.baseURL + "/articles/" + id + fragment
+	})
+}
+
+// Resolve finds the article a relative .md link from fromPath points to
+func (ix *Index) Resolve(target string, angle bool, fromPath string) (Article, string, bool) {
+	filePart, fragment := target, ""
+	if i := strings.Index(target, "#"); i != -1 {
+		filePart, fragment = target[:i], target[i:]
+	}
+	if !IsLocalArticleLink(filePart) {
+		return Article{}, "", false
+	}
+	if !angle {
+		decoded, err := url.PathUnescape(filePart)
+		if err != nil {
+			return Article{}, "", false
+		}
+		filePart = decoded
+	}
+
+	resolved := filepath.Clean(filepath.Join(filepath.Dir(fromPath), filepath.FromSlash(filePart)))
+	article, ok := ix.byPath[resolved]
+	return article, fragment, ok
+}
+
+// IsLocalArticleLink reports whether a target, without #anchor, is a
+// relative link to a markdown file
+func IsLocalArticleLink(target string) bool {
+	return strings.HasSuffix(target, ".md") &&
+		!strings.Contains(target, "://") &&
+		!strings.HasPrefix(target, "/")
+}
+
+// relativeTarget writes the path from one article file to another as a
+// link target
+func relativeTarget(fromPath, toPath string, angle bool) string {
+	rel, err := filepath.Rel(filepath.Dir(fromPath), toPath)
+	if err != nil {
+		rel = toPath
+	}
+	rel = filepath.ToSlash(rel)
+	if angle {
+		return rel
+	}
+
+	segments := strings.Split(rel, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return path.Join(segments...)
+}
@@ -0,0 +1,202 @@
+package lint
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ytkb/internal/links"
+	"ytkb/internal/markdown"
+)
+
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// Issue is a problem found in a workspace file
+type Issue struct {
+	Path     string   `json:"path"`
+	Line     int      `json:"line"`
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s [%s]", i.Path, i.Line, i.Severity, i.Message, i.Rule)
+}
+
+// File is a workspace markdown file. Err is set if it could not be parsed.
+type File struct {
+	Path string
+	MD   *markdown.MarkdownFile
+	Err  error
+}
+
+// Linter checks workspace files without changing anything
+type Linter struct {
+	// Index resolves links to articles; Known holds every article id and
+	// idReadable that exists, locally, in the sync state or on the server.
+	Index *links.Index
+	Known map[string]bool
+}
+
+// Check runs every rule over files and returns issues sorted by position
+func (l *Linter) Check(files []File) []Issue {
+	var issues []Issue
+	add := func(path string, line int, rule string, severity Severity, format string, args ...interface{}) {
+		if line < 1 {
+			line = 1
+		}
+		issues = append(issues, Issue{
+			Path:     path,
+			Line:     line,
+			Rule:     rule,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	paths := make(map[string]bool)
+	for _, file := range files {
+		paths[filepath.Clean(file.Path)] = true
+	}
+
+	byID := make(map[string][]File)
+	siblings := make(map[string][]File)
+
+	for _, file := range files {
+		if file.Err != nil {
+			add(file.Path, 1, "invalid-frontmatter", Error, "%v", file.Err)
+			continue
+		}
+		fm := file.MD.Frontmatter
+
+		if strings.TrimSpace(fm.Title) == "" {
+			add(file.Path, fm.Line("title"), "empty-title", Error, "title is empty")
+		} else {
+			key := filepath.Join(filepath.Dir(file.Path), strings.ToLower(strings.TrimSpace(fm.Title)))
+			siblings[key] = append(siblings[key], file)
+		}
+
+		if fm.ID != "" {
+			byID[fm.ID] = append(byID[fm.ID], file)
+		}
+
+		// Articles in a folder belong to the article of the same name
+		if dir := filepath.Dir(file.Path); dir != "." {
+			if !paths[dir+".md"] {
+				add(file.Path, 1, "missing-parent", Warning, "no parent article %s", filepath.ToSlash(dir+".md"))
+			}
+		}
+
+		l.checkLinks(file, add)
+	}
+
+	for id, files := range byID {
+		if len(files) < 2 {
+			continue
+		}
+		for _, file := range files {
+			add(file.Path, file.MD.Frontmatter.Line("id"), "duplicate-id", Error,
+				"id %s is also used by %s", id, otherPaths(files, file))
+		}
+	}
+
+	for _, files := range siblings {
+		if len(files) < 2 {
+			continue
+		}
+		for _, file := range files {
+			add(file.Path, file.MD.Frontmatter.Line("title"), "duplicate-title", Error,
+				"title %q is also used by %s", file.MD.Frontmatter.Title, otherPaths(files, file))
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Path != issues[j].Path {
+			return issues[i].Path < issues[j].Path
+		}
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Rule < issues[j].Rule
+	})
+	return issues
+}
+
+func (l *Linter) checkLinks(file File, add func(string, int, string, Severity, string, ...interface{})) {
+	offset := file.MD.BodyLine() - 1
+
+	for _, link := range markdown.Links(file.MD.Content) {
+		line := offset + link.Line
+		target := link.Target
+
+		// Links to articles in server form
+		if ref, _, ok := l.Index.ArticleRef(target); ok {
+			if !l.Known[ref] {
+				add(file.Path, line, "unknown-article", Warning, "link to unknown article %s", ref)
+			}
+			continue
+		}
+
+		if target == "" || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "/") ||
+			strings.Contains(target, "://") || strings.HasPrefix(target, "mailto:") {
+			continue
+		}
+
+		// Relative links to local files
+		if i := strings.IndexAny(target, "#?"); i != -1 {
+			target = target[:i]
+		}
+		if !link.Angle {
+			if decoded, err := url.PathUnescape(target); err == nil {
+				target = decoded
+			}
+		}
+		resolved := filepath.Join(filepath.Dir(file.Path), filepath.FromSlash(target))
+		if _, err := os.Stat(resolved); err == nil {
+			continue
+		}
+
+		switch {
+		case link.Image:
+			add(file.Path, line, "missing-image", Error, "image %s does not exist", link.Target)
+		default:
+			add(file.Path, line, "broken-link", Error, "link target %s does not exist", link.Target)
+		}
+	}
+}
+
+// HasErrors reports whether any issue is an error
+func HasErrors(issues []Issue) bool {
+	return CountErrors(issues) > 0
+}
+
+// CountErrors returns how many issues are errors rather than warnings
+func CountErrors(issues []Issue) int {
+	count := 0
+	for _, issue := range issues {
+		if issue.Severity == Error {
+			count++
+		}
+	}
+	return count
+}
+
+func otherPaths(files []File, self File) string {
+	var others []string
+	for _, file := range files {
+		if file.Path != self.Path {
+			others = append(others, filepath.ToSlash(file.Path))
+		}
+	}
+	sort.Strings(others)
+	return strings.Join(others, ", ")
+}
@@ -0,0 +1,105 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// bulletItem matches list items using * or + as their marker
+	bulletItem = regexp.MustCompile(`^(\s*)[*+]( +|\t)`)
+	// orderedItem matches ordered list items using ) as their delimiter
+	orderedItem = regexp.MustCompile(`^(\s*\d{1,9})\)( +|\t)`)
+	// orderedDot matches ordered list items in canonical form
+	orderedDot = regexp.MustCompile(`^\s*\d{1,9}\.( +|\t)`)
+	// thematicBreak matches horizontal rules such as *** or * * *
+	thematicBreak = regexp.MustCompile(`^ {0,3}(?:(?:\* *){3,}|(?:- *){3,}|(?:_ *){3,})$`)
+	// listItem matches any list item that is not itself indented code
+	listItem = regexp.MustCompile(`^ {0,3}(?:[-*+]|\d{1,9}[.)])(?: +|\t|$)`)
+	// indented matches lines indented enough to be code
+	indented = regexp.MustCompile(`^(?: {4}|\t)`)
+)
+
+// Format rewrites a markdown body into the canonical form YouTrack stores:
+// LF line endings, no trailing whitespace other than hard line breaks, "-"
+// bullets, "1." ordered lists and a single final newline. Fenced and
+// indented code blocks are left alone apart from line endings.
+func Format(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := strings.Split(content, "\n")
+	inFence := ""
+	// Indented code starts after a blank line outside of lists, where
+	// indentation continues the list item instead
+	inCode, inList, afterBlank := false, false, true
+
+	for i, line := range lines {
+		if m := fence.FindStringSubmatch(line); m != nil {
+			if inFence == "" {
+				inFence = m[1]
+			} else if m[1] == inFence {
+				inFence = ""
+			}
+			lines[i] = strings.TrimRight(line, " \t")
+			continue
+		}
+		if inFence != "" {
+			continue
+		}
+
+		blank := strings.TrimSpace(line) == ""
+		switch {
+		case indented.MatchString(line) && (inCode || (afterBlank && !inList)):
+			inCode = true
+		case blank:
+		default:
+			inCode = false
+			if listItem.MatchString(line) {
+				inList = true
+			} else if !indented.MatchString(line) && afterBlank {
+				inList = false
+			}
+		}
+		afterBlank = blank
+		if inCode {
+			continue
+		}
+
+		trimmed := strings.TrimRight(line, " \t")
+		if strings.HasSuffix(line, "  ") && trimmed != "" && i+1 < len(lines) && continuesParagraph(lines[i+1]) {
+			// Keep hard line breaks, written as exactly two spaces
+			trimmed += "  "
+		}
+		line = trimmed
+		if !thematicBreak.MatchString(line) {
+			line = bulletItem.ReplaceAllString(line, "$1-$2")
+		}
+		line = orderedItem.ReplaceAllString(line, "$1.$2")
+		lines[i] = line
+	}
+
+	formatted := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if formatted == "" {
+		return ""
+	}
+	return formatted + "\n"
+}
+
+// continuesParagraph reports whether a line continues the paragraph above
+// it, which is the only place a hard line break means anything
+func continuesParagraph(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" &&
+		!strings.HasPrefix(trimmed, "#") &&
+		!bulletItem.MatchString(line) && !strings.HasPrefix(trimmed, "- ") &&
+		!orderedItem.MatchString(line) && !orderedDot.MatchString(line) &&
+		fence.FindString(line) == ""
+}
+
+// Format returns the file's body formatted, in the file's own line endings
+func (md *MarkdownFile) Format() string {
+	formatted := Format(md.Content)
+	if md.LineEnding != "" && md.LineEnding != "\n" {
+		formatted = strings.ReplaceAll(formatted, "\n", md.LineEnding)
+	}
+	return formatted
+}
@@ -0,0 +1,130 @@
+package markdown
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "already canonical",
+			input: "# Title\n\n- a\n- b\n",
+			want:  "# Title\n\n- a\n- b\n",
+		},
+		{
+			name:  "CRLF",
+			input: "A  \r\n* b\r\n",
+			want:  "A\n- b\n",
+		},
+		{
+			name:  "trailing whitespace and final newlines",
+			input: "Text \t\n\n\n",
+			want:  "Text\n",
+		},
+		{
+			name:  "hard line break",
+			input: "First  \nSecond   \n",
+			want:  "First  \nSecond\n",
+		},
+		{
+			name:  "bullets and ordered lists",
+			input: "* a\n  + b\n1) one\n2) two\n",
+			want:  "- a\n  - b\n1. one\n2. two\n",
+		},
+		{
+			name:  "thematic break",
+			input: "Above\n\n* * *\n\nBelow\n",
+			want:  "Above\n\n* * *\n\nBelow\n",
+		},
+		{
+			name:  "fenced code",
+			input: "```\n* not a list  \n1) kept\n```  \n~~~\n+ x \n~~~\n",
+			want:  "```\n* not a list  \n1) kept\n```\n~~~\n+ x \n~~~\n",
+		},
+		{
+			name:  "fenced code with CRLF",
+			input: "```\r\n* code  \r\n```\r\n",
+			want:  "```\n* code  \n```\n",
+		},
+		{
+			name:  "indented code",
+			input: "Text\n\n    * code  \n\n    1) more\n\nAfter  \n",
+			want:  "Text\n\n    * code  \n\n    1) more\n\nAfter\n",
+		},
+		{
+			name:  "tab indented code",
+			input: "\t* code  \n",
+			want:  "\t* code  \n",
+		},
+		{
+			name:  "indented list continuation is not code",
+			input: "* item\n\n    continued  \n* two\n",
+			want:  "- item\n\n    continued\n- two\n",
+		},
+		{
+			name:  "indented paragraph continuation is not code",
+			input: "Para\n    lazy  \n* x\n",
+			want:  "Para\n    lazy\n- x\n",
+		},
+		{
+			name:  "empty",
+			input: "\n\n",
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Format(tt.input); got != tt.want {
+				t.Errorf("Format(%q)\n got %q\nwant %q", tt.input, got, tt.want)
+			}
+			// Formatting is idempotent
+			if got := Format(tt.want); got != tt.want {
+				t.Errorf("Format is not idempotent on %q: got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFormatFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "LF",
+			input: "---\ntitle: X\n---\nA  \n* b\n",
+			want:  "---\ntitle: X\n---\nA\n- b\n",
+		},
+		{
+			name:  "CRLF",
+			input: "---\r\ntitle: X\r\n---\r\nA  \r\n* b\r\n",
+			want:  "---\r\ntitle: X\r\n---\r\nA\r\n- b\r\n",
+		},
+		{
+			name:  "CRLF with code",
+			input: "---\r\ntitle: X\r\n---\r\n```\r\n* a  \r\n```\r\n\r\n    * b  \r\n",
+			want:  "---\r\ntitle: X\r\n---\r\n```\r\n* a  \r\n```\r\n\r\n    * b  \r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := ParseMarkdown(tt.input)
+			if err != nil {
+				t.Fatalf("ParseMarkdown: %v", err)
+			}
+			md.Content = md.Format()
+			got, err := md.Render()
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("formatted file\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package markdown
+
+import (
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Frontmatter struct {
+	ID    string `yaml:"id,omitempty"`
+	Title string `yaml:"title"`
+	URL   string `yaml:"url,omitempty"`
+
+	// Read-only article metadata. Download records it for reviewers; it is
+	// never compared or pushed.
+	IDReadable string `yaml:"id_readable,omitempty"`
+	Parent     string `yaml:"parent,omitempty"`
+	Created    string `yaml:"created,omitempty"`
+	Reporter   string `yaml:"reporter,omitempty"`
+	Updated    string `yaml:"updated,omitempty"`
+	UpdatedBy  string `yaml:"updated_by,omitempty"`
+
+	// Tags are synced with the article's YouTrack tags unless "tags" is
+	// declared local-only. Files without a tags key leave tags alone; only
+	// an explicit empty list removes them.
+	Tags []string `yaml:"tags,omitempty"`
+	// hasTags is set when the tags key is present, even if empty
+	hasTags bool
+
+	// node is the mapping the frontmatter was parsed from. It keeps custom
+	// keys, their order and comments so they survive a rewrite.
+	node *yaml.Node
+	// local holds keys declared local-only; they are never decoded into the
+	// fields above and are always carried through as custom keys.
+	local map[string]bool
+}
+
+// field binds a frontmatter key to the struct field holding its value.
+type field struct {
+	key       string
+	omitempty bool
+	value     func(fm *Frontmatter) interface{}
+}
+
+var fields = []field{
+	{"id", true, func(fm *Frontmatter) interface{} { return &fm.ID }},
+	{"id_readable", true, func(fm *Frontmatter) interface{} { return &fm.IDReadable }},
+	{"title", false, func(fm *Frontmatter) interface{} { return &fm.Title }},
+	{"url", true, func(fm *Frontmatter) interface{} { return &fm.URL }},
+	{"parent", true, func(fm *Frontmatter) interface{} { return &fm.Parent }},
+	{"created", true, func(fm *Frontmatter) interface{} { return &fm.Created }},
+	{"reporter", true, func(fm *Frontmatter) interface{} { return &fm.Reporter }},
+	{"updated", true, func(fm *Frontmatter) interface{} { return &fm.Updated }},
+	{"updated_by", true, func(fm *Frontmatter) interface{} { return &fm.UpdatedBy }},
+	{"tags", true, func(fm *Frontmatter) interface{} { return &fm.Tags }},
+}
+
+// encode returns the field's current value as a node, or nil if the key
+// should be omitted.
+func (f field) encode(fm *Frontmatter) (*yaml.Node, error) {
+	value := reflect.ValueOf(f.value(fm)).Elem()
+	empty := value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0)
+	// An empty tags list is kept when given, as it removes the tags
+	if f.omitempty && empty && !(f.key == "tags" && fm.hasTags) {
+		return nil, nil
+	}
+	if value.Kind() == reflect.Slice && value.IsNil() {
+		// Written as [] rather than null
+		value = reflect.MakeSlice(value.Type(), 0, 0)
+	}
+
+	var node yaml.Node
+	if err := node.Encode(value.Interface()); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+func lookupField(key string) (field, bool) {
+	for _, f := range fields {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// decodeFrontmatter reads a YAML document into fm. Keys listed in localKeys
+// are kept as custom keys even if they name a known field.
+func decodeFrontmatter(data []byte, localKeys []string) (Frontmatter, error) {
+	fm := Frontmatter{}
+	if len(localKeys) > 0 {
+		fm.local = make(map[string]bool, len(localKeys))
+		for _, key := range localKeys {
+			fm.local[key] = true
+		}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fm, err
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 {
+		// Empty frontmatter
+		return fm, nil
+	}
+
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fm, fmt.Errorf("frontmatter must be a mapping")
+	}
+	fm.node = mapping
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i].Value, mapping.Content[i+1]
+		f, ok := lookupField(key)
+		if !ok || fm.local[key] {
+			continue
+		}
+		if err := value.Decode(f.value(&fm)); err != nil {
+			return fm, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if key == "tags" {
+			fm.hasTags = true
+		}
+	}
+
+	return fm, nil
+}
+
+// Get returns the raw value of a custom key, or nil if it is not set.
+func (fm Frontmatter) Get(key string) *yaml.Node {
+	if fm.node == nil {
+		return nil
+	}
+	for i := 0; i+1 < len(fm.node.Content); i += 2 {
+		if fm.node.Content[i].Value == key {
+			return fm.node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Set stores a custom key. Existing keys keep their position and comments.
+func (fm *Frontmatter) Set(key string, value interface{}) error {
+	var valueNode yaml.Node
+	if err := valueNode.Encode(value); err != nil {
+		return err
+	}
+
+	if fm.node == nil {
+		fm.node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	if existing := fm.Get(key); existing != nil {
+		setValue(existing, &valueNode)
+		return nil
+	}
+	fm.node.Content = append(fm.node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&valueNode,
+	)
+	return nil
+}
+
+// Line returns the 1-based line of the file on which key is set, or 0 if
+// it is not set.
+func (fm Frontmatter) Line(key string) int {
+	if fm.node == nil {
+		return 0
+	}
+	for i := 0; i+1 < len(fm.node.Content); i += 2 {
+		if fm.node.Content[i].Value == key {
+			// Frontmatter starts after the opening delimiter line
+			return fm.node.Content[i].Line + 1
+		}
+	}
+	return 0
+}
+
+// HasTags reports whether the tags key is present, even as an empty list
+func (fm Frontmatter) HasTags() bool {
+	return fm.hasTags
+}
+
+// SetTags sets the tags and always writes the key, so that an article
+// without tags is told apart from a file that does not sync them
+func (fm *Frontmatter) SetTags(tags []string) {
+	fm.Tags = tags
+	fm.hasTags = true
+}
+
+// IsLocal reports whether key was declared local-only.
+func (fm Frontmatter) IsLocal(key string) bool {
+	return fm.local[key]
+}
+
+// MarshalYAML writes known fields and custom keys in their original order,
+// followed by any known fields that were not present before.
+func (fm Frontmatter) MarshalYAML() (interface{}, error) {
+	out := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	written := make(map[string]bool)
+
+	if fm.node != nil {
+		out.HeadComment = fm.node.HeadComment
+		out.FootComment = fm.node.FootComment
+		for i := 0; i+1 < len(fm.node.Content); i += 2 {
+			keyNode, valueNode := fm.node.Content[i], fm.node.Content[i+1]
+			f, ok := lookupField(keyNode.Value)
+			if !ok || fm.local[keyNode.Value] {
+				out.Content = append(out.Content, keyNode, valueNode)
+				continue
+			}
+
+			written[f.key] = true
+			value, err := f.encode(&fm)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				continue
+			}
+			updated := *valueNode
+			setValue(&updated, value)
+			out.Content = append(out.Content, keyNode, &updated)
+		}
+	}
+
+	for _, f := range fields {
+		if written[f.key] || fm.local[f.key] {
+			continue
+		}
+		value, err := f.encode(&fm)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+		out.Content = append(out.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: f.key},
+			value,
+		)
+	}
+
+	return out, nil
+}
+
+// sameValue reports whether two nodes hold the same data, ignoring style
+// and comments.
+func sameValue(a, b *yaml.Node) bool {
+	if a.Kind != b.Kind || a.Value != b.Value || len(a.Content) != len(b.Content) {
+		return false
+	}
+	if a.Kind == yaml.ScalarNode && a.ShortTag() != b.ShortTag() {
+		return false
+	}
+	for i := range a.Content {
+		if !sameValue(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// setValue replaces dst's value with src's while keeping dst's comments.
+// The original style is kept when the value did not change.
+func setValue(dst, src *yaml.Node) {
+	if sameValue(dst, src) {
+		return
+	}
+	if dst.Kind != src.Kind || dst.Kind == yaml.ScalarNode {
+		// Collections keep their flow or block style
+		dst.Style = src.Style
+	}
+	dst.Kind = src.Kind
+	dst.Tag = src.Tag
+	dst.Value = src.Value
+	dst.Content = src.Content
+	dst.Anchor = ""
+	dst.Alias = nil
+}
@@ -0,0 +1,114 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Link is a link or image reference found in a markdown body
+type Link struct {
+	Target string
+	Image  bool
+	// Angle is set for targets written as <target>, which may contain spaces
+	Angle bool
+	// Line is the 1-based line number within the body
+	Line int
+}
+
+var (
+	// inlineLink matches [text](target "title") and ![alt](target)
+	inlineLink = regexp.MustCompile(`(!?)\[((?:[^\[\]]|\[[^\]]*\])*)\]\(\s*(<[^>]*>|[^()\s]*(?:\([^()\s]*\)[^()\s]*)*)((?:\s+(?:"[^"]*"|'[^']*'|\([^)]*\)))?\s*)\)`)
+	// refDefinition matches reference definitions: [label]: target "title"
+	refDefinition = regexp.MustCompile(`^( {0,3}\[[^\]]+\]:[ \t]*)(<[^>]*>|\S+)(.*)$`)
+	fence         = regexp.MustCompile("^ {0,3}(```|~~~)")
+)
+
+// Links lists the link and image targets of a markdown body, skipping code.
+func Links(content string) []Link {
+	var links []Link
+	RewriteLinks(content, func(link Link) string {
+		links = append(links, link)
+		return link.Target
+	})
+	return links
+}
+
+// RewriteLinks replaces every link and image target with the value returned
+// by fn. Code blocks and code spans are left alone, and targets fn returns
+// unchanged are kept byte for byte.
+func RewriteLinks(content string, fn func(Link) string) string {
+	var builder strings.Builder
+	inFence := ""
+
+	for i, line := range strings.SplitAfter(content, "\n") {
+		lineNo := i + 1
+
+		if m := fence.FindStringSubmatch(line); m != nil {
+			if inFence == "" {
+				inFence = m[1]
+			} else if m[1] == inFence {
+				inFence = ""
+			}
+			builder.WriteString(line)
+			continue
+		}
+		if inFence != "" {
+			builder.WriteString(line)
+			continue
+		}
+
+		body, ending := splitEnding(line)
+		if m := refDefinition.FindStringSubmatch(body); m != nil {
+			builder.WriteString(m[1])
+			builder.WriteString(rewriteTarget(m[2], Link{Line: lineNo}, fn))
+			builder.WriteString(m[3])
+			builder.WriteString(ending)
+			continue
+		}
+
+		// Only rewrite outside of `code spans`
+		segments := strings.Split(body, "`")
+		for j := range segments {
+			if j%2 == 1 && j < len(segments)-1 {
+				continue
+			}
+			segments[j] = inlineLink.ReplaceAllStringFunc(segments[j], func(match string) string {
+				m := inlineLink.FindStringSubmatch(match)
+				link := Link{Image: m[1] == "!", Line: lineNo}
+				return m[1] + "[" + m[2] + "](" + rewriteTarget(m[3], link, fn) + m[4] + ")"
+			})
+		}
+		builder.WriteString(strings.Join(segments, "`"))
+		builder.WriteString(ending)
+	}
+
+	return builder.String()
+}
+
+// rewriteTarget applies fn to a raw target, keeping angle brackets.
+func rewriteTarget(raw string, link Link, fn func(Link) string) string {
+	link.Angle = strings.HasPrefix(raw, "<") && strings.HasSuffix(raw, ">")
+	link.Target = raw
+	if link.Angle {
+		link.Target = raw[1 : len(raw)-1]
+	}
+
+	target := fn(link)
+	if target == link.Target {
+		return raw
+	}
+	if link.Angle || strings.ContainsAny(target, " \t") {
+		return "<" + target + ">"
+	}
+	return target
+}
+
+func splitEnding(line string) (string, string) {
+	if strings.HasSuffix(line, "\r\n") {
+		return line[:len(line)-2], "\r\n"
+	}
+	if strings.HasSuffix(line, "\n") {
+		return line[:len(line)-1], "\n"
+	}
+	return line, ""
+}
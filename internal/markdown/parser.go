@@ -1,6 +1,8 @@
 package markdown
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -8,67 +10,167 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-type Frontmatter struct {
-	ID    string `yaml:"id,omitempty"`
-	Title string `yaml:"title"`
-	URL   string `yaml:"url,omitempty"`
-}
+const (
+	bom       = "\ufeff"
+	delimiter = "---"
+)
+
+// ErrNoFrontmatter is returned when a file does not start with a
+// frontmatter delimiter line.
+var ErrNoFrontmatter = errors.New("no frontmatter found")
 
 type MarkdownFile struct {
 	Frontmatter Frontmatter
 	Content     string
+
+	// BOM and LineEnding describe how the source file was encoded so that
+	// Render writes it back the same way.
+	BOM        bool
+	LineEnding string
+
+	// head is the original text up to the start of the body and parsed is
+	// the serialized frontmatter it decoded to. While Frontmatter still
+	// serializes the same way, head is written back verbatim.
+	head   string
+	parsed string
+	// closing is the original closing delimiter line, with its ending
+	closing string
 }
 
-func ParseMarkdown(content string) (*MarkdownFile, error) {
-	// Find frontmatter delimiters
-	frontmatterStart := strings.Index(content, "---\n")
-	if frontmatterStart == -1 {
-		return nil, fmt.Errorf("no frontmatter found")
+// ParseMarkdown splits a file into frontmatter and body. Frontmatter keys
+// listed in localKeys are preserved but never decoded into known fields.
+func ParseMarkdown(content string, localKeys ...string) (*MarkdownFile, error) {
+	md := &MarkdownFile{LineEnding: "\n"}
+
+	rest := content
+	if strings.HasPrefix(rest, bom) {
+		md.BOM = true
+		rest = rest[len(bom):]
 	}
 
-	frontmatterEnd := strings.Index(content[frontmatterStart+4:], "---\n")
-	if frontmatterEnd == -1 {
+	// The opening delimiter must be the very first line
+	line, le, rest := nextLine(rest)
+	if !isDelimiter(line) || le == "" {
+		return nil, ErrNoFrontmatter
+	}
+	md.LineEnding = le
+
+	// Collect frontmatter lines up to the closing delimiter
+	var frontmatterText strings.Builder
+	closed := false
+	for rest != "" {
+		line, le, rest = nextLine(rest)
+		if isDelimiter(line) || strings.TrimRight(line, " \t") == "..." {
+			closed = true
+			md.closing = line + le
+			break
+		}
+		frontmatterText.WriteString(line)
+		frontmatterText.WriteString(le)
+	}
+	if !closed {
 		return nil, fmt.Errorf("invalid frontmatter: no closing delimiter")
 	}
 
-	frontmatterText := content[frontmatterStart+4 : frontmatterStart+4+frontmatterEnd]
-	bodyStart := frontmatterStart + 4 + frontmatterEnd + 4
-
-	var frontmatter Frontmatter
-	if err := yaml.Unmarshal([]byte(frontmatterText), &frontmatter); err != nil {
+	frontmatter, err := decodeFrontmatter([]byte(frontmatterText.String()), localKeys)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse frontmatter: %w", err)
 	}
 
-	body := ""
-	if bodyStart < len(content) {
-		body = content[bodyStart:]
+	parsed, err := marshalYAML(&frontmatter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse frontmatter: %w", err)
 	}
 
-	return &MarkdownFile{
-		Frontmatter: frontmatter,
-		Content:     body,
-	}, nil
+	md.Frontmatter = frontmatter
+	md.parsed = string(parsed)
+	md.Content = rest
+	md.head = content[:len(content)-len(rest)]
+
+	return md, nil
 }
 
-func WriteMarkdown(fm Frontmatter, content string) (string, error) {
-	var builder strings.Builder
+// BodyLine returns the 1-based line of the file on which the body starts
+func (md *MarkdownFile) BodyLine() int {
+	return strings.Count(md.head, "\n") + 1
+}
 
-	builder.WriteString("---\n")
+// Render serializes the file. An unmodified file round-trips byte for byte.
+func (md *MarkdownFile) Render() (string, error) {
+	var builder strings.Builder
 
 	// Write YAML frontmatter
-	yamlData, err := yaml.Marshal(&fm)
+	yamlData, err := marshalYAML(&md.Frontmatter)
 	if err != nil {
 		return "", err
 	}
-	builder.Write(yamlData)
 
-	builder.WriteString("---\n")
-	builder.WriteString(content)
+	if md.head != "" && string(yamlData) == md.parsed {
+		builder.WriteString(md.head)
+		builder.WriteString(md.Content)
+		return builder.String(), nil
+	}
+
+	le := md.LineEnding
+	if le == "" {
+		le = "\n"
+	}
+
+	if md.BOM {
+		builder.WriteString(bom)
+	}
+	builder.WriteString(delimiter + le)
+	builder.WriteString(strings.ReplaceAll(string(yamlData), "\n", le))
+
+	// The closing delimiter is kept as written, "..." or without a newline
+	if md.closing != "" {
+		builder.WriteString(md.closing)
+	} else {
+		builder.WriteString(delimiter + le)
+	}
+	builder.WriteString(md.Content)
 
 	return builder.String(), nil
 }
 
-func UpdateFrontmatterID(filePath string, articleID string) error {
+func WriteMarkdown(fm Frontmatter, content string) (string, error) {
+	md := &MarkdownFile{Frontmatter: fm, Content: content}
+	return md.Render()
+}
+
+// marshalYAML encodes v with the two-space indent used in frontmatter.
+func marshalYAML(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// nextLine splits s into its first line, that line's ending ("\n", "\r\n"
+// or "" at end of input) and the remainder.
+func nextLine(s string) (line, ending, rest string) {
+	i := strings.IndexByte(s, '\n')
+	if i == -1 {
+		return s, "", ""
+	}
+	line, rest = s[:i], s[i+1:]
+	if strings.HasSuffix(line, "\r") {
+		return line[:len(line)-1], "\r\n", rest
+	}
+	return line, "\n", rest
+}
+
+func isDelimiter(line string) bool {
+	return strings.TrimRight(line, " \t") == delimiter
+}
+
+func UpdateFrontmatterID(filePath string, articleID string, localKeys ...string) error {
 	// Read file
 	content, err := readFile(filePath)
 	if err != nil {
@@ -76,7 +178,7 @@ func UpdateFrontmatterID(filePath string, articleID string) error {
 	}
 
 	// Parse
-	md, err := ParseMarkdown(content)
+	md, err := ParseMarkdown(content, localKeys...)
 	if err != nil {
 		return err
 	}
@@ -85,7 +187,7 @@ func UpdateFrontmatterID(filePath string, articleID string) error {
 	md.Frontmatter.ID = articleID
 
 	// Write back
-	newContent, err := WriteMarkdown(md.Frontmatter, md.Content)
+	newContent, err := md.Render()
 	if err != nil {
 		return err
 	}
@@ -104,4 +206,3 @@ func readFile(path string) (string, error) {
 func writeFile(path string, content string) error {
 	return os.WriteFile(path, []byte(content), 0644)
 }
-
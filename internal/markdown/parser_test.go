@@ -0,0 +1,106 @@
+package markdown
+
+import "testing"
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// changed is the file after setting the id, which is added as a
+		// new key at the end, or "" to only check the unchanged round trip
+		changed string
+	}{
+		{
+			name:    "LF",
+			input:   "---\ntitle: A\n---\nBody\n",
+			changed: "---\ntitle: A\nid: 1-1\n---\nBody\n",
+		},
+		{
+			name:    "CRLF",
+			input:   "---\r\ntitle: A\r\n---\r\nBody\r\nMore\r\n",
+			changed: "---\r\ntitle: A\r\nid: 1-1\r\n---\r\nBody\r\nMore\r\n",
+		},
+		{
+			name:    "BOM",
+			input:   "\ufeff---\ntitle: A\n---\nBody\n",
+			changed: "\ufeff---\ntitle: A\nid: 1-1\n---\nBody\n",
+		},
+		{
+			name:    "delimiter in body",
+			input:   "---\ntitle: A\n---\nAbove\n---\nBelow\n",
+			changed: "---\ntitle: A\nid: 1-1\n---\nAbove\n---\nBelow\n",
+		},
+		{
+			name:    "empty body",
+			input:   "---\ntitle: A\n---\n",
+			changed: "---\ntitle: A\nid: 1-1\n---\n",
+		},
+		{
+			name:    "no newline after closing delimiter",
+			input:   "---\ntitle: A\n---",
+			changed: "---\ntitle: A\nid: 1-1\n---",
+		},
+		{
+			name:    "dots terminator",
+			input:   "---\ntitle: A\n...\nBody\n",
+			changed: "---\ntitle: A\nid: 1-1\n...\nBody\n",
+		},
+		{
+			name:    "comments and custom keys",
+			input:   "---\n# Owned by docs team\ntitle: A # short\nowner: sam\ncustom:\n  nested: [1, 2]\n---\nBody\n",
+			changed: "---\n# Owned by docs team\ntitle: A # short\nowner: sam\ncustom:\n  nested: [1, 2]\nid: 1-1\n---\nBody\n",
+		},
+		{
+			name:  "unusual formatting",
+			input: "---   \ntitle:    'A'\ntags: [ x,  y ]\n---\nBody",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := ParseMarkdown(tt.input)
+			if err != nil {
+				t.Fatalf("ParseMarkdown: %v", err)
+			}
+			got, err := md.Render()
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got != tt.input {
+				t.Errorf("unchanged round trip:\n got %q\nwant %q", got, tt.input)
+			}
+
+			if tt.changed == "" {
+				return
+			}
+			md.Frontmatter.ID = "1-1"
+			got, err = md.Render()
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got != tt.changed {
+				t.Errorf("after change:\n got %q\nwant %q", got, tt.changed)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"no frontmatter", "# Title\n"},
+		{"not closed", "---\ntitle: A\nBody\n"},
+		{"invalid YAML", "---\ntitle: [A\n---\n"},
+		{"not a mapping", "---\n- A\n---\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseMarkdown(tt.input); err == nil {
+				t.Errorf("ParseMarkdown(%q) succeeded, want an error", tt.input)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package plan
+
+import (
+	"os"
+
+	"ytkb/internal/api"
+	"ytkb/internal/assets"
+	"ytkb/internal/state"
+)
+
+type AttachmentStatus int
+
+const (
+	AttachmentAdded AttachmentStatus = iota
+	AttachmentRemoved
+	AttachmentChanged
+	AttachmentOrphaned
+)
+
+// AttachmentChange is a difference between an article's local and server
+// attachments
+type AttachmentChange struct {
+	Name   string
+	Status AttachmentStatus
+	// Path is the local file and Hash its content, if there is one
+	Path string
+	Hash string
+	// ID is the server attachment, if there is one
+	ID string
+	// Referenced is set while the article body still refers to the attachment
+	Referenced bool
+}
+
+// Prunable reports whether the server attachment may be removed
+func (c AttachmentChange) Prunable() bool {
+	return (c.Status == AttachmentRemoved || c.Status == AttachmentOrphaned) && !c.Referenced
+}
+
+// Upload reports whether the local file has to be sent to the server
+func (c AttachmentChange) Upload() bool {
+	return c.Status == AttachmentAdded || c.Status == AttachmentChanged
+}
+
+func (c AttachmentChange) String() string {
+	switch c.Status {
+	case AttachmentAdded:
+		return "📎 + " + c.Name
+	case AttachmentRemoved:
+		if c.Referenced {
+			return "📎 - " + c.Name + " (removed locally but still referenced)"
+		}
+		return "📎 - " + c.Name
+	case AttachmentChanged:
+		return "📎 ~ " + c.Name
+	case AttachmentOrphaned:
+		return "📎 ? " + c.Name + " (not referenced)"
+	}
+	return c.Name
+}
+
+// DiffAttachments compares an article's server attachments with its local
+// files. body is the content as it would be pushed and uploads the new files
+// it refers to.
+func DiffAttachments(filePath, body string, uploads []assets.Upload, article *api.Article, st *state.State) []AttachmentChange {
+	var changes []AttachmentChange
+	for _, upload := range uploads {
+		changes = append(changes, AttachmentChange{
+			Name:       upload.Name,
+			Status:     AttachmentAdded,
+			Path:       upload.Path,
+			Hash:       upload.Hash,
+			Referenced: true,
+		})
+	}
+
+	var recorded map[string]state.Attachment
+	if entry, ok := st.Articles[article.ID]; ok {
+		recorded = entry.Attachments
+	}
+	referenced := assets.References(body)
+
+	for _, attachment := range article.Attachments {
+		change := AttachmentChange{
+			Name:       attachment.Name,
+			ID:         attachment.ID,
+			Path:       assets.Path(filePath, attachment.Name),
+			Referenced: referenced[attachment.Name],
+		}
+		synced, wasSynced := recorded[attachment.Name]
+
+		if _, err := os.Stat(change.Path); err != nil {
+			// Only report files that were downloaded and then deleted
+			if wasSynced {
+				change.Status = AttachmentRemoved
+				changes = append(changes, change)
+			} else if !change.Referenced {
+				change.Status = AttachmentOrphaned
+				changes = append(changes, change)
+			}
+			continue
+		}
+
+		hash, err := assets.Hash(change.Path)
+		if err == nil && wasSynced && synced.Hash != "" && hash != synced.Hash {
+			change.Status = AttachmentChanged
+			change.Hash = hash
+			changes = append(changes, change)
+			continue
+		}
+		if !change.Referenced {
+			change.Status = AttachmentOrphaned
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+// hasUploads reports whether any attachment has to be sent to the server
+func hasUploads(changes []AttachmentChange) bool {
+	for _, change := range changes {
+		if change.Upload() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package plan
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"ytkb/internal/api"
+	"ytkb/internal/assets"
+	"ytkb/internal/compare"
+	"ytkb/internal/content"
+	"ytkb/internal/filesystem"
+	"ytkb/internal/markdown"
+	"ytkb/internal/state"
+)
+
+// File is a workspace markdown file. Err is set if it could not be read or
+// parsed. Hash is the content as read.
+type File struct {
+	Path string
+	Hash string
+	MD   *markdown.MarkdownFile
+	Err  error
+}
+
+// ReadFiles reads every markdown file of the workspace at basePath
+func ReadFiles(basePath string, localKeys ...string) ([]File, error) {
+	paths, err := filesystem.FindMarkdownFiles(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find local files: %w", err)
+	}
+
+	files := make([]File, 0, len(paths))
+	for _, path := range paths {
+		file := File{Path: filepath.Join(basePath, path)}
+		data, err := filesystem.ReadMarkdownFile(file.Path)
+		if err == nil {
+			file.Hash = assets.HashBytes([]byte(data))
+			file.MD, err = markdown.ParseMarkdown(data, localKeys...)
+		}
+		file.Err = err
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// Create is a local file without a matching server article
+type Create struct {
+	Path  string
+	Title string
+	// ID is set if the file names an article the server doesn't have
+	ID string
+}
+
+// Orphan is a local file whose article was deleted on the server
+type Orphan struct {
+	ID    string
+	Path  string
+	Title string
+}
+
+// Update brings a server article in line with its local file
+type Update struct {
+	ID    string
+	Path  string
+	Title string
+	// Content is the body in server form. Modified is set if it, or any
+	// attachment, has to be sent.
+	Content     string
+	Modified    bool
+	Renamed     bool
+	Tags        TagDiff
+	Attachments []AttachmentChange
+	Article     *api.Article
+}
+
+// Changed reports whether the article itself differs from its file.
+// Attachments the server could prune don't count.
+func (u Update) Changed() bool {
+	return u.Modified || u.Renamed || !u.Tags.Empty()
+}
+
+// Prunable lists the server attachments the article no longer uses
+func (u Update) Prunable() []AttachmentChange {
+	var prunable []AttachmentChange
+	for _, change := range u.Attachments {
+		if change.Prunable() {
+			prunable = append(prunable, change)
+		}
+	}
+	return prunable
+}
+
+// Move is an article whose file sits under a different parent than on the
+// server. Parents are article ids, empty for the top level.
+type Move struct {
+	ID    string
+	Path  string
+	Title string
+	From  string
+	To    string
+}
+
+// Rename is an article whose file has a different title than on the server
+type Rename struct {
+	ID   string
+	Path string
+	From string
+	To   string
+}
+
+// Conflict is an article claimed by more than one local file
+type Conflict struct {
+	ID    string
+	Paths []string
+}
+
+// Deletion is a server article whose local file was deleted
+type Deletion struct {
+	ID    string
+	Title string
+	URL   string
+}
+
+// Download is a server article that was never downloaded
+type Download struct {
+	ID    string
+	Title string
+	URL   string
+}
+
+// Invalid is a local file that could not be read
+type Invalid struct {
+	Path string
+	Err  error
+}
+
+// Plan is everything that differs between the workspace and the server.
+// An article can be updated, renamed and moved at the same time.
+type Plan struct {
+	Creates   []Create
+	Orphans   []Orphan
+	Updates   []Update
+	Moves     []Move
+	Renames   []Rename
+	Conflicts []Conflict
+	Deletions []Deletion
+	Downloads []Download
+	Invalid   []Invalid
+
+	// Server holds every server article and Paths the local file of each
+	// one that has exactly one
+	Server []api.Article
+	Paths  map[string]string
+}
+
+// Planner compares local files with the server
+type Planner struct {
+	BaseURL string
+	State   *state.State
+	Rules   compare.Rules
+}
+
+// Plan works out what pushing files to the server would change
+func (p *Planner) Plan(files []File, server []api.Article) *Plan {
+	plan := &Plan{Server: server, Paths: make(map[string]string)}
+
+	serverByID := make(map[string]*api.Article)
+	for i := range server {
+		serverByID[server[i].ID] = &server[i]
+	}
+
+	byID := make(map[string][]File)
+	for _, file := range files {
+		if file.Err != nil {
+			plan.Invalid = append(plan.Invalid, Invalid{Path: file.Path, Err: file.Err})
+			continue
+		}
+		fm := file.MD.Frontmatter
+		if fm.ID == "" {
+			plan.Creates = append(plan.Creates, Create{Path: file.Path, Title: fm.Title})
+			continue
+		}
+		byID[fm.ID] = append(byID[fm.ID], file)
+	}
+
+	// Links can point to any file with an id, even one the server lacks
+	linkPaths := make(map[string]string)
+	mds := make(map[string]*markdown.MarkdownFile)
+	for id, claimed := range byID {
+		if len(claimed) > 1 {
+			conflict := Conflict{ID: id}
+			for _, file := range claimed {
+				conflict.Paths = append(conflict.Paths, file.Path)
+			}
+			sort.Strings(conflict.Paths)
+			plan.Conflicts = append(plan.Conflicts, conflict)
+			continue
+		}
+
+		file := claimed[0]
+		linkPaths[id] = file.Path
+		if _, ok := serverByID[id]; !ok {
+			// Synced before, so it was deleted on the server since
+			if _, synced := p.State.Articles[id]; synced {
+				plan.Orphans = append(plan.Orphans, Orphan{ID: id, Path: file.Path, Title: file.MD.Frontmatter.Title})
+			} else {
+				plan.Creates = append(plan.Creates, Create{Path: file.Path, Title: file.MD.Frontmatter.Title, ID: id})
+			}
+			continue
+		}
+		plan.Paths[id] = file.Path
+		mds[id] = file.MD
+	}
+
+	conv := content.NewConverter(p.BaseURL, p.State, content.LinkArticles(linkPaths, serverByID, p.State))
+	byPath := make(map[string]string)
+	for id, path := range linkPaths {
+		byPath[filepath.Clean(path)] = id
+	}
+
+	for id, path := range plan.Paths {
+		article, md := serverByID[id], mds[id]
+
+		body, uploads := conv.ServerContent(path, md, article)
+		update := Update{
+			ID:          id,
+			Path:        path,
+			Title:       md.Frontmatter.Title,
+			Content:     body,
+			Tags:        DiffTags(md, article),
+			Attachments: DiffAttachments(path, body, uploads, article, p.State),
+			Article:     article,
+		}
+		update.Modified = !compare.Equal(body, article.Content, p.Rules) || hasUploads(update.Attachments)
+
+		// An empty title is a lint error, never a rename
+		if update.Title == "" {
+			update.Title = article.Title
+		}
+		if update.Title != article.Title {
+			update.Renamed = true
+			plan.Renames = append(plan.Renames, Rename{ID: id, Path: path, From: article.Title, To: update.Title})
+		}
+
+		if update.Changed() || len(update.Attachments) > 0 {
+			plan.Updates = append(plan.Updates, update)
+		}
+
+		from := ""
+		if article.ParentID != nil {
+			from = *article.ParentID
+		}
+		if to, ok := localParent(path, byPath); ok && to != from {
+			plan.Moves = append(plan.Moves, Move{ID: id, Path: path, Title: update.Title, From: from, To: to})
+		}
+	}
+
+	// Only articles the sync state knows were downloaded can be deleted,
+	// and only if their file is really gone rather than unreadable
+	invalid := make(map[string]bool, len(plan.Invalid))
+	for _, file := range plan.Invalid {
+		invalid[filepath.Clean(file.Path)] = true
+	}
+	for i := range server {
+		article := &server[i]
+		if _, ok := byID[article.ID]; ok {
+			continue
+		}
+		if entry, ok := p.State.Articles[article.ID]; ok && entry.Path != "" {
+			if invalid[filepath.Clean(entry.Path)] || exists(entry.Path) {
+				continue
+			}
+			plan.Deletions = append(plan.Deletions, Deletion{ID: article.ID, Title: article.Title, URL: article.URL})
+		} else {
+			plan.Downloads = append(plan.Downloads, Download{ID: article.ID, Title: article.Title, URL: article.URL})
+		}
+	}
+
+	sort.Slice(plan.Creates, func(i, j int) bool { return plan.Creates[i].Path < plan.Creates[j].Path })
+	sort.Slice(plan.Orphans, func(i, j int) bool { return plan.Orphans[i].Path < plan.Orphans[j].Path })
+	sort.Slice(plan.Updates, func(i, j int) bool { return plan.Updates[i].Path < plan.Updates[j].Path })
+	sort.Slice(plan.Moves, func(i, j int) bool { return plan.Moves[i].Path < plan.Moves[j].Path })
+	sort.Slice(plan.Renames, func(i, j int) bool { return plan.Renames[i].Path < plan.Renames[j].Path })
+	sort.Slice(plan.Conflicts, func(i, j int) bool { return plan.Conflicts[i].ID < plan.Conflicts[j].ID })
+	return plan
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// localParent finds the article a file's folder belongs to. ok is false if
+// the folder has no article file with an id.
+func localParent(path string, byPath map[string]string) (string, bool) {
+	dir := filepath.Dir(filepath.Clean(path))
+	if dir == "." {
+		return "", true
+	}
+	id, ok := byPath[dir+".md"]
+	return id, ok
+}
+
+// Pushable lists the updates a push sends. Updates that could only prune
+// attachments are included if prune is set.
+func (p *Plan) Pushable(prune bool) []Update {
+	var updates []Update
+	for _, update := range p.Updates {
+		if update.Changed() || (prune && len(update.Prunable()) > 0) {
+			updates = append(updates, update)
+		}
+	}
+	return updates
+}
+
+// Update returns the update for an article, if there is one
+func (p *Plan) Update(id string) (Update, bool) {
+	for _, update := range p.Updates {
+		if update.ID == id {
+			return update, true
+		}
+	}
+	return Update{}, false
+}
+
+// Title returns the server title of an article
+func (p *Plan) Title(id string) string {
+	for _, article := range p.Server {
+		if article.ID == id {
+			return article.Title
+		}
+	}
+	return id
+}
@@ -0,0 +1,54 @@
+package plan
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ytkb/internal/api"
+	"ytkb/internal/state"
+)
+
+func TestPlanDeletions(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     []File
+		deletions int
+	}{
+		{"file deleted", nil, 1},
+		{"file unreadable", []File{{Path: "A.md", Err: errors.New("invalid frontmatter")}}, 0},
+		{"unreadable file under another path", []File{{Path: "./A.md", Err: errors.New("invalid frontmatter")}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &state.State{Articles: map[string]*state.Article{"1-1": {Path: "A.md"}}}
+			planner := &Planner{State: st}
+			p := planner.Plan(tt.files, []api.Article{{ID: "1-1", Title: "A"}})
+
+			if len(p.Deletions) != tt.deletions {
+				t.Errorf("deletions = %v, want %d", p.Deletions, tt.deletions)
+			}
+			if len(p.Downloads) != 0 {
+				t.Errorf("downloads = %v, want none", p.Downloads)
+			}
+		})
+	}
+}
+
+func TestPlanKeepsArticlesWhoseFileExists(t *testing.T) {
+	// A file that exists but was not read, such as one out of scope
+	path := filepath.Join(t.TempDir(), "A.md")
+	if err := os.WriteFile(path, []byte("---\ntitle: A\n---\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	st := &state.State{Articles: map[string]*state.Article{"1-1": {Path: path}}}
+	planner := &Planner{State: st}
+	p := planner.Plan(nil, []api.Article{{ID: "1-1", Title: "A"}})
+
+	if len(p.Deletions) != 0 {
+		t.Errorf("deletions = %v, want none", p.Deletions)
+	}
+}
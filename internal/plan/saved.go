@@ -0,0 +1,245 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"ytkb/internal/api"
+	"ytkb/internal/assets"
+)
+
+// SavedVersion is the version of the plan file format
+const SavedVersion = 1
+
+// Options are the push settings a plan was made with
+type Options struct {
+	Format     bool `json:"format,omitempty"`
+	CreateTags bool `json:"createTags,omitempty"`
+	Prune      bool `json:"pruneAttachments,omitempty"`
+	Delete     bool `json:"delete,omitempty"`
+	Recursive  bool `json:"recursive,omitempty"`
+	Archive    bool `json:"archive,omitempty"`
+}
+
+// Saved is a plan written to a file for review. It records every change
+// push would make and what the server and workspace looked like, so it
+// can only be applied to the exact state it was made for.
+type Saved struct {
+	Version int      `json:"version"`
+	URL     string   `json:"url"`
+	KB      string   `json:"kb"`
+	Options Options  `json:"options"`
+	Changes []Change `json:"changes"`
+	// Removals are the articles deleted or archived, NewTags the tags
+	// created. Both are filled in by the caller.
+	Removals []Removal `json:"removals,omitempty"`
+	NewTags  []string  `json:"newTags,omitempty"`
+
+	// Server maps article ids to a fingerprint of the article, Local paths
+	// of markdown files to a hash of their content
+	Server map[string]string `json:"server"`
+	Local  map[string]string `json:"local"`
+}
+
+// Change is an article update in a saved plan. Content is the hash of the
+// body that is sent, empty if the body isn't.
+type Change struct {
+	ID         string            `json:"id"`
+	Path       string            `json:"path"`
+	Title      string            `json:"title"`
+	RenameFrom string            `json:"renameFrom,omitempty"`
+	Content    string            `json:"contentHash,omitempty"`
+	AddTags    []string          `json:"addTags,omitempty"`
+	RemoveTags []string          `json:"removeTags,omitempty"`
+	Uploads    []SavedAttachment `json:"uploads,omitempty"`
+	Prune      []string          `json:"prune,omitempty"`
+}
+
+// Removal is an article a saved plan deletes or archives, together with
+// its sub-articles
+type Removal struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Descendants []string `json:"descendants,omitempty"`
+}
+
+type SavedAttachment struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// Save records the plan's pushable changes together with the files and
+// server articles it was computed from
+func (p *Plan) Save(url, kb string, opts Options, files []File) *Saved {
+	saved := &Saved{
+		Version: SavedVersion,
+		URL:     url,
+		KB:      kb,
+		Options: opts,
+		Changes: []Change{},
+		Server:  make(map[string]string),
+		Local:   make(map[string]string),
+	}
+
+	for _, update := range p.Pushable(opts.Prune) {
+		saved.Changes = append(saved.Changes, savedChange(update, opts.Prune))
+	}
+	for i := range p.Server {
+		saved.Server[p.Server[i].ID] = Fingerprint(&p.Server[i])
+	}
+	for _, file := range files {
+		saved.Local[file.Path] = file.Hash
+	}
+	return saved
+}
+
+func savedChange(update Update, prune bool) Change {
+	change := Change{
+		ID:      update.ID,
+		Path:    update.Path,
+		Title:   update.Title,
+		AddTags: update.Tags.Add,
+	}
+	if update.Renamed {
+		change.RenameFrom = update.Article.Title
+	}
+	if update.Modified || update.Renamed {
+		change.Content = assets.HashBytes([]byte(update.Content))
+		for _, attachment := range update.Attachments {
+			if attachment.Upload() {
+				change.Uploads = append(change.Uploads, SavedAttachment{
+					Name: attachment.Name,
+					Path: attachment.Path,
+					Hash: attachment.Hash,
+				})
+			}
+		}
+	}
+	for _, tag := range update.Tags.Remove {
+		change.RemoveTags = append(change.RemoveTags, tag.Name)
+	}
+	if prune {
+		for _, attachment := range update.Prunable() {
+			change.Prune = append(change.Prune, attachment.Name)
+		}
+	}
+	return change
+}
+
+// Fingerprint identifies the server version of an article
+func Fingerprint(article *api.Article) string {
+	parent := ""
+	if article.ParentID != nil {
+		parent = *article.ParentID
+	}
+	var tags, attachments []string
+	for _, tag := range article.Tags {
+		tags = append(tags, tag.Name)
+	}
+	for _, attachment := range article.Attachments {
+		attachments = append(attachments, attachment.ID+":"+attachment.Name)
+	}
+	sort.Strings(tags)
+	sort.Strings(attachments)
+
+	data, _ := json.Marshal([]interface{}{
+		article.Title, article.Content, parent, article.Updated.UnixMilli(), tags, attachments,
+	})
+	return assets.HashBytes(data)
+}
+
+// Drift lists what changed since a saved plan was made: server articles
+// and local files that were added, removed or modified
+func (s *Saved) Drift(p *Plan, files []File) (server, local []string) {
+	current := make(map[string]string)
+	titles := make(map[string]string)
+	for i := range p.Server {
+		current[p.Server[i].ID] = Fingerprint(&p.Server[i])
+		titles[p.Server[i].ID] = p.Server[i].Title
+	}
+	for _, id := range changedKeys(s.Server, current) {
+		if title, ok := titles[id]; ok {
+			server = append(server, fmt.Sprintf("%s (%s)", title, id))
+		} else {
+			server = append(server, id+" (deleted)")
+		}
+	}
+
+	hashes := make(map[string]string)
+	for _, file := range files {
+		hashes[file.Path] = file.Hash
+	}
+	local = changedKeys(s.Local, hashes)
+
+	// Attachments are uploaded from disk when the plan is applied
+	for _, change := range s.Changes {
+		for _, upload := range change.Uploads {
+			if hash, err := assets.Hash(upload.Path); err != nil || hash != upload.Hash {
+				local = append(local, upload.Path)
+			}
+		}
+	}
+	return server, local
+}
+
+// Same reports whether two plans make the same changes, removals and tags
+func (s *Saved) Same(other *Saved) bool {
+	actions := func(saved *Saved) string {
+		data, _ := json.Marshal(struct {
+			Changes  []Change  `json:"changes,omitempty"`
+			Removals []Removal `json:"removals,omitempty"`
+			NewTags  []string  `json:"newTags,omitempty"`
+		}{saved.Changes, saved.Removals, saved.NewTags})
+		return string(data)
+	}
+	return actions(s) == actions(other)
+}
+
+// changedKeys lists keys that are missing from either map or differ
+func changedKeys(before, after map[string]string) []string {
+	var keys []string
+	for key, value := range before {
+		if after[key] != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReadSaved loads a plan file
+func ReadSaved(path string) (*Saved, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	var saved Saved
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
+	}
+	if saved.Version != SavedVersion {
+		return nil, fmt.Errorf("unsupported plan version %d", saved.Version)
+	}
+	return &saved, nil
+}
+
+// Write saves a plan file
+func (s *Saved) Write(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
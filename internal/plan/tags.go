@@ -0,0 +1,62 @@
+package plan
+
+import (
+	"sort"
+	"strings"
+
+	"ytkb/internal/api"
+	"ytkb/internal/markdown"
+)
+
+// TagDiff lists the tag changes needed to make an article match its file
+type TagDiff struct {
+	Add    []string
+	Remove []api.Tag
+}
+
+func (d TagDiff) Empty() bool {
+	return len(d.Add) == 0 && len(d.Remove) == 0
+}
+
+func (d TagDiff) String() string {
+	var parts []string
+	for _, name := range d.Add {
+		parts = append(parts, "+"+name)
+	}
+	for _, tag := range d.Remove {
+		parts = append(parts, "-"+tag.Name)
+	}
+	return strings.Join(parts, " ")
+}
+
+// DiffTags compares the tags in a file's frontmatter with the article's.
+// Files without a tags key, or that declare it local, never sync tags.
+func DiffTags(md *markdown.MarkdownFile, article *api.Article) TagDiff {
+	var diff TagDiff
+	if md.Frontmatter.IsLocal("tags") || !md.Frontmatter.HasTags() {
+		return diff
+	}
+
+	local := make(map[string]bool)
+	for _, name := range md.Frontmatter.Tags {
+		local[name] = true
+	}
+	server := make(map[string]bool)
+	for _, tag := range article.Tags {
+		server[tag.Name] = true
+		if !local[tag.Name] {
+			diff.Remove = append(diff.Remove, tag)
+		}
+	}
+	for name := range local {
+		if !server[name] {
+			diff.Add = append(diff.Add, name)
+		}
+	}
+
+	sort.Strings(diff.Add)
+	sort.Slice(diff.Remove, func(i, j int) bool {
+		return diff.Remove[i].Name < diff.Remove[j].Name
+	})
+	return diff
+}
@@ -0,0 +1,144 @@
+package scope
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"ytkb/internal/api"
+	"ytkb/internal/filesystem"
+)
+
+// Scope is the part of a knowledge base a workspace works with: a set of
+// root articles and everything below them. A nil Scope is the whole
+// knowledge base.
+type Scope struct {
+	Roots []*api.Article
+	ids   map[string]bool
+	// dirs are where the roots are written locally, without .md
+	dirs []string
+}
+
+// New resolves roots, given by id, readable id or title path such as
+// Guides/Setup, against the server articles
+func New(roots []string, articles []api.Article) (*Scope, error) {
+	if len(roots) == 0 {
+		return nil, nil
+	}
+
+	t := newTree(articles)
+	s := &Scope{ids: make(map[string]bool)}
+	for _, root := range roots {
+		article := t.find(root)
+		if article == nil {
+			return nil, fmt.Errorf("workspace root %s not found on server", root)
+		}
+		s.Roots = append(s.Roots, article)
+		s.dirs = append(s.dirs, strings.TrimSuffix(t.path(article), ".md"))
+		t.walk(article, func(a *api.Article) { s.ids[a.ID] = true })
+	}
+	return s, nil
+}
+
+// Contains reports whether an article is in scope
+func (s *Scope) Contains(id string) bool {
+	return s == nil || s.ids[id]
+}
+
+// ContainsPath reports whether a local file is inside a root's folder
+func (s *Scope) ContainsPath(path string) bool {
+	if s == nil {
+		return true
+	}
+	path = strings.TrimSuffix(filepath.Clean(path), ".md")
+	for _, dir := range s.dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Articles drops the articles outside the scope
+func (s *Scope) Articles(articles []api.Article) []api.Article {
+	if s == nil {
+		return articles
+	}
+	scoped := make([]api.Article, 0, len(s.ids))
+	for _, article := range articles {
+		if s.ids[article.ID] {
+			scoped = append(scoped, article)
+		}
+	}
+	return scoped
+}
+
+// tree indexes articles by id and parent
+type tree struct {
+	byID     map[string]*api.Article
+	children map[string][]*api.Article
+}
+
+func newTree(articles []api.Article) *tree {
+	t := &tree{byID: make(map[string]*api.Article), children: make(map[string][]*api.Article)}
+	for i := range articles {
+		article := &articles[i]
+		t.byID[article.ID] = article
+		parent := ""
+		if article.ParentID != nil {
+			parent = *article.ParentID
+		}
+		t.children[parent] = append(t.children[parent], article)
+	}
+	return t
+}
+
+func (t *tree) find(root string) *api.Article {
+	if article, ok := t.byID[root]; ok {
+		return article
+	}
+	for _, article := range t.byID {
+		if article.IDReadable == root {
+			return article
+		}
+	}
+
+	// Walk the titles down from the top level
+	var found *api.Article
+	parent := ""
+	for _, segment := range strings.Split(strings.Trim(filepath.ToSlash(root), "/"), "/") {
+		found = nil
+		for _, child := range t.children[parent] {
+			if child.Title == segment || filesystem.SanitizeFilename(child.Title) == segment {
+				found = child
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		parent = found.ID
+	}
+	return found
+}
+
+// path is where download writes an article
+func (t *tree) path(article *api.Article) string {
+	path := filesystem.SanitizeFilename(article.Title) + ".md"
+	for article.ParentID != nil {
+		parent, ok := t.byID[*article.ParentID]
+		if !ok {
+			break
+		}
+		path = filepath.Join(filesystem.SanitizeFilename(parent.Title), path)
+		article = parent
+	}
+	return path
+}
+
+func (t *tree) walk(article *api.Article, fn func(*api.Article)) {
+	fn(article)
+	for _, child := range t.children[article.ID] {
+		t.walk(child, fn)
+	}
+}
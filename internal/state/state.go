@@ -0,0 +1,91 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Dir is the workspace directory holding ytkb's own bookkeeping
+const Dir = ".ytkb"
+
+const fileName = "state.json"
+
+// State records what was last synced with the server
+type State struct {
+	// URL is the server the articles were synced with
+	URL      string              `json:"url,omitempty"`
+	Articles map[string]*Article `json:"articles"`
+}
+
+type Article struct {
+	Path        string                `json:"path"`
+	IDReadable  string                `json:"idReadable,omitempty"`
+	Attachments map[string]Attachment `json:"attachments,omitempty"`
+	// Links maps rewritten local link targets to their server form
+	Links map[string]string `json:"links,omitempty"`
+}
+
+type Attachment struct {
+	ID   string `json:"id"`
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// Load reads the state of the workspace at basePath. A workspace that was
+// never synced has an empty state.
+func Load(basePath string) (*State, error) {
+	s := &State{Articles: make(map[string]*Article)}
+
+	data, err := os.ReadFile(filepath.Join(basePath, Dir, fileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state: %w", err)
+	}
+	if s.Articles == nil {
+		s.Articles = make(map[string]*Article)
+	}
+	return s, nil
+}
+
+// Save writes the state of the workspace at basePath
+func (s *State) Save(basePath string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(basePath, Dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, fileName), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	return nil
+}
+
+// Article returns the recorded entry for an article, creating it if needed
+func (s *State) Article(id string) *Article {
+	article, ok := s.Articles[id]
+	if !ok {
+		article = &Article{}
+		s.Articles[id] = article
+	}
+	return article
+}
+
+// SetAttachment records the synced version of an attachment
+func (a *Article) SetAttachment(name string, attachment Attachment) {
+	if a.Attachments == nil {
+		a.Attachments = make(map[string]Attachment)
+	}
+	a.Attachments[name] = attachment
+}